@@ -0,0 +1,372 @@
+package cmd
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	cometnet "github.com/cometbft/cometbft/libs/net"
+
+	"github.com/strangelove-ventures/horcrux-proxy/privval"
+)
+
+const (
+	// adminSocketMode is the file mode of the unix socket of the admin API.
+	adminSocketMode os.FileMode = 0600
+
+	// maxAdminRequestSize is the max size of an admin API request body.
+	maxAdminRequestSize = 1 << 20
+
+	// adminShutdownTimeout is how long in-flight admin API requests are
+	// waited for on shutdown.
+	adminShutdownTimeout = 5 * time.Second
+)
+
+// errInvalidSentry is returned for an ad-hoc sentry with invalid settings.
+var errInvalidSentry = errors.New("invalid sentry")
+
+// AdminOptions configure the admin API, which lists the sentries and changes
+// them at runtime.
+type AdminOptions struct {
+	// Address to serve the API on, a loopback tcp address (e.g.
+	// tcp://127.0.0.1:9090) or a unix socket (e.g. unix:///run/horcrux-proxy/admin.sock).
+	Address string
+
+	// TokenFile is the path of a file with the bearer token that requests must
+	// authenticate with. It is re-read on every request, so the token can be
+	// rotated without a restart.
+	TokenFile string
+}
+
+// enabled reports whether an address is configured.
+func (o AdminOptions) enabled() bool {
+	return o.Address != ""
+}
+
+// validate returns an error if any of the options is invalid.
+func (o AdminOptions) validate() error {
+	if o.Address == "" {
+		return nil
+	}
+	var errs []error
+	proto, address := cometnet.ProtocolAndAddress(o.Address)
+	switch proto {
+	case "unix":
+		if address == "" {
+			errs = append(errs, fmt.Errorf("invalid admin address %q, missing socket path", o.Address))
+		}
+	case "tcp":
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid admin address %q, must be tcp://HOST:PORT or unix://PATH", o.Address))
+			break
+		}
+		// Host names are not accepted, since they may resolve to any address.
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			errs = append(errs, fmt.Errorf("invalid admin address %q, must be a loopback IP address", o.Address))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid admin address %q, must be tcp://HOST:PORT or unix://PATH", o.Address))
+	}
+	if o.TokenFile == "" {
+		errs = append(errs, errors.New("admin token file is required"))
+	}
+	return errors.Join(errs...)
+}
+
+// Sentries returns the status of the sentries of all the sources.
+func (w *SentryWatcher) Sentries() []SentryStatus {
+	return w.reconciler.status()
+}
+
+// AddSentry adds an ad-hoc sentry, or replaces the one at the same address.
+// Ad-hoc sentries are kept apart from the sentries of the config file, so they
+// are not affected by reloads, and are lost on restart.
+func (w *SentryWatcher) AddSentry(s StaticSentry) error {
+	if s.Address == "" {
+		return fmt.Errorf("%w: address is required", errInvalidSentry)
+	}
+	config, err := s.config(w.defaultSentryConfig(w.maxReadSize))
+	if err != nil {
+		return fmt.Errorf("%w %s: %w", errInvalidSentry, s.Address, err)
+	}
+	errs := w.reconciler.add(sourceAPI, s.Address, desiredSentry{address: s.Address, config: config, log: w.log})
+	return ReconcileResult{Errors: errs}.Err()
+}
+
+// RemoveSentry removes an ad-hoc sentry. The sentry stays connected if other
+// sources discover it.
+func (w *SentryWatcher) RemoveSentry(address string) error {
+	errs, err := w.reconciler.remove(sourceAPI, address)
+	if err != nil {
+		return err
+	}
+	return ReconcileResult{Errors: errs}.Err()
+}
+
+// DrainSentry disconnects a sentry and keeps it disconnected, e.g. during its
+// maintenance, until UndrainSentry is called. The address is prefixed by
+// "cluster/" for sentries of other clusters.
+func (w *SentryWatcher) DrainSentry(address string) error {
+	errs, err := w.reconciler.drain(address)
+	if err != nil {
+		return err
+	}
+	return ReconcileResult{Errors: errs}.Err()
+}
+
+// UndrainSentry reconnects a drained sentry.
+func (w *SentryWatcher) UndrainSentry(address string) error {
+	errs, err := w.reconciler.undrain(address)
+	if err != nil {
+		return err
+	}
+	return ReconcileResult{Errors: errs}.Err()
+}
+
+// DisconnectSentry closes the connection to a sentry, which is redialed right
+// away.
+func (w *SentryWatcher) DisconnectSentry(address string) error {
+	errs, err := w.reconciler.disconnect(address)
+	if err != nil {
+		return err
+	}
+	return ReconcileResult{Errors: errs}.Err()
+}
+
+// PauseDiscovery keeps the discovered sentries as they are until
+// ResumeDiscovery is called. Static and ad-hoc sentries can still be changed.
+func (w *SentryWatcher) PauseDiscovery() {
+	w.reconciler.pause()
+}
+
+// ResumeDiscovery applies the changes discovered since PauseDiscovery.
+func (w *SentryWatcher) ResumeDiscovery() error {
+	return ReconcileResult{Errors: w.reconciler.resume()}.Err()
+}
+
+// DiscoveryPaused reports whether discovery is paused.
+func (w *SentryWatcher) DiscoveryPaused() bool {
+	return w.reconciler.isPaused()
+}
+
+// adminServer serves the admin API of a SentryWatcher.
+type adminServer struct {
+	opts    AdminOptions
+	watcher *SentryWatcher
+	log     cometlog.Logger
+
+	ln     net.Listener
+	server *http.Server
+}
+
+// newAdminServer returns an adminServer of the options that listens on its
+// address.
+func newAdminServer(opts AdminOptions, watcher *SentryWatcher, logger cometlog.Logger) (*adminServer, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	proto, address := cometnet.ProtocolAndAddress(opts.Address)
+	var ln net.Listener
+	var err error
+	if proto == "unix" {
+		// The socket file is restricted right after it is created, requests
+		// must carry the token regardless.
+		ln, err = privval.ListenUnix(address, adminSocketMode)
+	} else {
+		ln, err = net.Listen(proto, address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on admin address: %w", err)
+	}
+
+	s := &adminServer{
+		opts:    opts,
+		watcher: watcher,
+		log:     logger,
+		ln:      ln,
+	}
+	s.server = &http.Server{
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s, nil
+}
+
+// serve serves the API until stop is called.
+func (s *adminServer) serve() {
+	s.log.Info("Serving admin API", "address", s.opts.Address)
+	if err := s.server.Serve(s.ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.log.Error("Failed to serve admin API", "error", err)
+	}
+}
+
+// stop stops serving the API, after the in-flight requests are done.
+func (s *adminServer) stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), adminShutdownTimeout)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+// handler returns the authenticated handler of the API.
+//
+//	GET    /v1/sentries                          list the sentries
+//	POST   /v1/sentries                          add an ad-hoc sentry
+//	DELETE /v1/sentries?address=ADDRESS          remove an ad-hoc sentry
+//	POST   /v1/sentries/drain?address=ADDRESS    disconnect a sentry until it is undrained
+//	POST   /v1/sentries/undrain?address=ADDRESS  reconnect a drained sentry
+//	POST   /v1/sentries/disconnect?address=ADDRESS
+//	                                             close the connection to a sentry, which is redialed
+//	GET    /v1/discovery                         whether discovery is paused
+//	POST   /v1/discovery/pause                   pause discovery
+//	POST   /v1/discovery/resume                  resume discovery
+func (s *adminServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/sentries", s.handleSentries)
+	mux.HandleFunc("/v1/sentries/drain", s.handleSentryAction(s.watcher.DrainSentry))
+	mux.HandleFunc("/v1/sentries/undrain", s.handleSentryAction(s.watcher.UndrainSentry))
+	mux.HandleFunc("/v1/sentries/disconnect", s.handleSentryAction(s.watcher.DisconnectSentry))
+	mux.HandleFunc("/v1/discovery", s.handleDiscovery)
+	mux.HandleFunc("/v1/discovery/pause", s.handleDiscoveryAction(func() error {
+		s.watcher.PauseDiscovery()
+		return nil
+	}))
+	mux.HandleFunc("/v1/discovery/resume", s.handleDiscoveryAction(s.watcher.ResumeDiscovery))
+	return s.authenticate(mux)
+}
+
+// authenticate only lets requests with the bearer token of the token file
+// through.
+func (s *adminServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := os.ReadFile(s.opts.TokenFile)
+		if err != nil {
+			s.log.Error("Failed to read admin token file", "error", err)
+			writeAdminError(w, http.StatusInternalServerError, errors.New("failed to read admin token file"))
+			return
+		}
+		want := "Bearer " + strings.TrimSpace(string(token))
+		got := r.Header.Get("Authorization")
+		if strings.TrimSpace(string(token)) == "" || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+			writeAdminError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *adminServer) handleSentries(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeAdminJSON(w, http.StatusOK, s.watcher.Sentries())
+	case http.MethodPost:
+		var sentry StaticSentry
+		bz, err := readAdminBody(w, r)
+		if err == nil {
+			err = decodeStrict(bz, &sentry)
+		}
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, fmt.Errorf("failed to decode sentry: %w", err))
+			return
+		}
+		s.log.Info("Adding ad-hoc sentry through admin API", "address", sentry.Address)
+		s.writeResult(w, s.watcher.AddSentry(sentry))
+	case http.MethodDelete:
+		address := r.URL.Query().Get("address")
+		s.log.Info("Removing ad-hoc sentry through admin API", "address", address)
+		s.writeResult(w, s.watcher.RemoveSentry(address))
+	default:
+		writeAdminError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// handleSentryAction returns the handler of a POST request that applies action
+// to the sentry at the address of the query.
+func (s *adminServer) handleSentryAction(action func(address string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeAdminError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		address := r.URL.Query().Get("address")
+		s.log.Info("Changing sentry through admin API", "path", r.URL.Path, "address", address)
+		s.writeResult(w, action(address))
+	}
+}
+
+func (s *adminServer) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAdminError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, adminDiscovery{Paused: s.watcher.DiscoveryPaused()})
+}
+
+// handleDiscoveryAction returns the handler of a POST request that applies
+// action to the discovery.
+func (s *adminServer) handleDiscoveryAction(action func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeAdminError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		s.log.Info("Changing discovery through admin API", "path", r.URL.Path)
+		if err := action(); err != nil {
+			s.writeResult(w, err)
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, adminDiscovery{Paused: s.watcher.DiscoveryPaused()})
+	}
+}
+
+// adminDiscovery is the discovery state returned by the admin API.
+type adminDiscovery struct {
+	Paused bool `json:"paused"`
+}
+
+// adminError is the body of an admin API error response.
+type adminError struct {
+	Error string `json:"error"`
+}
+
+// writeResult writes the response of a change, with the status of its error.
+// Sentries that failed to connect are kept and retried, so their errors are
+// reported with a 502.
+func (s *adminServer) writeResult(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, errUnknownSentry):
+		writeAdminError(w, http.StatusNotFound, err)
+	case errors.Is(err, errInvalidSentry):
+		writeAdminError(w, http.StatusBadRequest, err)
+	default:
+		s.log.Error("Failed to change sentries through admin API", "error", err)
+		writeAdminError(w, http.StatusBadGateway, err)
+	}
+}
+
+func readAdminBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	defer r.Body.Close()
+	return io.ReadAll(http.MaxBytesReader(w, r.Body, maxAdminRequestSize))
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	writeAdminJSON(w, status, adminError{Error: err.Error()})
+}
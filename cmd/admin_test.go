@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/stretchr/testify/require"
+
+	"github.com/strangelove-ventures/horcrux-proxy/signer"
+)
+
+// adminClient is a client of the admin API on a unix socket.
+type adminClient struct {
+	t      *testing.T
+	client *http.Client
+	token  string
+}
+
+func (c adminClient) do(method, path, body string) (int, []byte) {
+	req, err := http.NewRequest(method, "http://admin"+path, strings.NewReader(body))
+	require.NoError(c.t, err)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+	require.NoError(c.t, err)
+	defer resp.Body.Close()
+	var bz json.RawMessage
+	_ = json.NewDecoder(resp.Body).Decode(&bz)
+	return resp.StatusCode, bz
+}
+
+func (c adminClient) sentries() map[string]SentryStatus {
+	status, bz := c.do(http.MethodGet, "/v1/sentries", "")
+	require.Equal(c.t, http.StatusOK, status)
+	var list []SentryStatus
+	require.NoError(c.t, json.Unmarshal(bz, &list))
+	sentries := make(map[string]SentryStatus, len(list))
+	for _, s := range list {
+		sentries[s.Address] = s
+	}
+	return sentries
+}
+
+func TestAdminServer(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("secret\n"), 0600))
+	socket := filepath.Join(dir, "admin.sock")
+
+	signers := newFakeSigners()
+	w, err := NewSentryWatcher(ctx, nil, cometlog.NewNopLogger(), false, nil, false, KubeOptions{},
+		[]StaticSentry{{Address: "tcp://a:1234"}}, 1024, SentryWatcherSignerFactory(signers.factory))
+	require.NoError(t, err)
+	go w.Watch(ctx, 1024)
+	t.Cleanup(func() { _ = w.Stop() })
+
+	admin, err := newAdminServer(AdminOptions{Address: "unix://" + socket, TokenFile: tokenFile}, w, cometlog.NewNopLogger())
+	require.NoError(t, err)
+	go admin.serve()
+	t.Cleanup(func() { _ = admin.stop() })
+
+	info, err := os.Stat(socket)
+	require.NoError(t, err)
+	require.Equal(t, adminSocketMode, info.Mode().Perm())
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+	c := adminClient{t: t, client: &http.Client{Transport: transport}, token: "secret"}
+
+	unauthenticated := adminClient{t: t, client: c.client}
+	status, _ := unauthenticated.do(http.MethodGet, "/v1/sentries", "")
+	require.Equal(t, http.StatusUnauthorized, status)
+	status, _ = adminClient{t: t, client: c.client, token: "wrong"}.do(http.MethodGet, "/v1/sentries", "")
+	require.Equal(t, http.StatusUnauthorized, status)
+
+	require.Eventually(t, func() bool {
+		return len(signers.addresses()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	sentries := c.sentries()
+	require.Len(t, sentries, 1)
+	require.Equal(t, sourceStatic, sentries["tcp://a:1234"].Source)
+	require.Equal(t, SentryConnecting, sentries["tcp://a:1234"].State)
+
+	// ad-hoc sentries
+	status, _ = c.do(http.MethodPost, "/v1/sentries", `{"address": "tcp://b:1234", "chainIDs": ["cosmoshub-4"]}`)
+	require.Equal(t, http.StatusNoContent, status)
+	status, _ = c.do(http.MethodPost, "/v1/sentries", `{"address": "tcp://a:1234", "dialTimeout": "5s"}`)
+	require.Equal(t, http.StatusNoContent, status)
+	require.Equal(t, []string{"tcp://a:1234", "tcp://b:1234"}, signers.addresses())
+	sentries = c.sentries()
+	require.Equal(t, sourceAPI, sentries["tcp://a:1234"].Source)
+	require.Equal(t, []string{sourceAPI, sourceStatic}, sentries["tcp://a:1234"].Sources)
+	require.Equal(t, []string{"cosmoshub-4"}, sentries["tcp://b:1234"].ChainIDs)
+
+	status, _ = c.do(http.MethodPost, "/v1/sentries", `{"address": "tcp://c:1234", "nodeID": "abc"}`)
+	require.Equal(t, http.StatusBadRequest, status)
+	status, _ = c.do(http.MethodPost, "/v1/sentries", `{"addr": "tcp://c:1234"}`)
+	require.Equal(t, http.StatusBadRequest, status)
+
+	// removing an ad-hoc sentry keeps the sentries of the config
+	status, _ = c.do(http.MethodDelete, "/v1/sentries?address=tcp://b:1234", "")
+	require.Equal(t, http.StatusNoContent, status)
+	status, _ = c.do(http.MethodDelete, "/v1/sentries?address=tcp://a:1234", "")
+	require.Equal(t, http.StatusNoContent, status)
+	status, _ = c.do(http.MethodDelete, "/v1/sentries?address=tcp://a:1234", "")
+	require.Equal(t, http.StatusNotFound, status)
+	require.Equal(t, []string{"tcp://a:1234"}, signers.addresses())
+	require.Equal(t, sourceStatic, c.sentries()["tcp://a:1234"].Source)
+
+	// drain and undrain
+	status, _ = c.do(http.MethodPost, "/v1/sentries/drain?address=tcp://a:1234", "")
+	require.Equal(t, http.StatusNoContent, status)
+	require.Empty(t, signers.addresses())
+	require.Equal(t, SentryDrained, c.sentries()["tcp://a:1234"].State)
+	require.NoError(t, w.SetStaticSentries([]StaticSentry{{Address: "tcp://a:1234"}}))
+	require.Empty(t, signers.addresses(), "drained sentries stay disconnected")
+	status, _ = c.do(http.MethodPost, "/v1/sentries/undrain?address=tcp://a:1234", "")
+	require.Equal(t, http.StatusNoContent, status)
+	require.Equal(t, []string{"tcp://a:1234"}, signers.addresses())
+
+	start := signers.startCount("tcp://a:1234")
+	status, _ = c.do(http.MethodPost, "/v1/sentries/disconnect?address=tcp://a:1234", "")
+	require.Equal(t, http.StatusNoContent, status)
+	require.Equal(t, []string{"tcp://a:1234"}, signers.addresses())
+	require.Equal(t, start+1, signers.startCount("tcp://a:1234"))
+
+	status, _ = c.do(http.MethodPost, "/v1/sentries/drain?address=tcp://z:1234", "")
+	require.Equal(t, http.StatusNotFound, status)
+	status, _ = c.do(http.MethodGet, "/v1/sentries/drain?address=tcp://a:1234", "")
+	require.Equal(t, http.StatusMethodNotAllowed, status)
+
+	// pause and resume discovery
+	status, bz := c.do(http.MethodPost, "/v1/discovery/pause", "")
+	require.Equal(t, http.StatusOK, status)
+	require.JSONEq(t, `{"paused": true}`, string(bz))
+	require.True(t, w.DiscoveryPaused())
+	status, bz = c.do(http.MethodPost, "/v1/discovery/resume", "")
+	require.Equal(t, http.StatusOK, status)
+	require.JSONEq(t, `{"paused": false}`, string(bz))
+	_, bz = c.do(http.MethodGet, "/v1/discovery", "")
+	require.JSONEq(t, `{"paused": false}`, string(bz))
+
+	// the token is re-read on every request
+	require.NoError(t, os.WriteFile(tokenFile, []byte("rotated"), 0600))
+	status, _ = c.do(http.MethodGet, "/v1/sentries", "")
+	require.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestAdminOptionsValidate(t *testing.T) {
+	require.NoError(t, AdminOptions{}.validate())
+	require.NoError(t, AdminOptions{Address: "tcp://127.0.0.1:9090", TokenFile: "token"}.validate())
+	require.NoError(t, AdminOptions{Address: "tcp://[::1]:9090", TokenFile: "token"}.validate())
+	require.NoError(t, AdminOptions{Address: "unix:///run/horcrux-proxy/admin.sock", TokenFile: "token"}.validate())
+	require.ErrorContains(t, AdminOptions{Address: "tcp://0.0.0.0:9090", TokenFile: "token"}.validate(), "must be a loopback IP address")
+	require.ErrorContains(t, AdminOptions{Address: "tcp://10.0.0.1:9090", TokenFile: "token"}.validate(), "must be a loopback IP address")
+	require.ErrorContains(t, AdminOptions{Address: "localhost:9090", TokenFile: "token"}.validate(), "must be a loopback IP address")
+	require.ErrorContains(t, AdminOptions{Address: "tcp://localhost:9090", TokenFile: "token"}.validate(), "must be a loopback IP address")
+	require.ErrorContains(t, AdminOptions{Address: "udp://127.0.0.1:9090", TokenFile: "token"}.validate(), "must be tcp://HOST:PORT")
+	require.ErrorContains(t, AdminOptions{Address: "tcp://127.0.0.1:9090"}.validate(), "admin token file is required")
+}
+
+func TestSentryStats(t *testing.T) {
+	s := newSentryStats()
+	state, stats := s.get()
+	require.Equal(t, SentryConnecting, state)
+	require.Zero(t, stats.Connects)
+
+	s.handle(signer.RemoteSignerHandshakeFailed, errors.New("node ID mismatch"))
+	state, stats = s.get()
+	require.Equal(t, SentryHandshakeFailed, state)
+	require.Equal(t, 1, stats.HandshakeFailures)
+	require.Equal(t, "node ID mismatch", stats.LastError)
+
+	s.handle(signer.RemoteSignerConnected, nil)
+	state, stats = s.get()
+	require.Equal(t, SentryConnected, state)
+	require.Equal(t, 1, stats.Connects)
+	require.NotNil(t, stats.ConnectedSince)
+
+	s.handle(signer.RemoteSignerRequestsFailing, errors.New("horcrux unavailable"))
+	s.handle(signer.RemoteSignerDisconnected, errors.New("EOF"))
+	state, stats = s.get()
+	require.Equal(t, SentryDisconnected, state)
+	require.Equal(t, 1, stats.RequestsFailing)
+	require.Equal(t, 1, stats.Disconnects)
+	require.Nil(t, stats.ConnectedSince)
+	require.Equal(t, "EOF", stats.LastError)
+}
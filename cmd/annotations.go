@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	cometp2p "github.com/cometbft/cometbft/p2p"
+
+	"github.com/strangelove-ventures/horcrux-proxy/signer"
+)
+
+// Annotations on a sentry Service that configure the connections to its pods.
+const (
+	annotationPrefix = "horcrux-proxy.strange.love/"
+
+	// annotationIgnore opts the Service out of discovery when "true".
+	annotationIgnore = annotationPrefix + "ignore"
+
+	// annotationChainIDs is a comma separated list of the chain IDs that
+	// requests are forwarded to horcrux for. Default all.
+	annotationChainIDs = annotationPrefix + "chain-ids"
+
+	// annotationMaxReadSize is the max read size of privval messages in bytes.
+	// Default --max-read-size.
+	annotationMaxReadSize = annotationPrefix + "max-read-size"
+
+	// annotationDialTimeout is the timeout for dialing the sentry, e.g. "5s".
+	annotationDialTimeout = annotationPrefix + "dial-timeout"
+
+	// annotationPriority orders the sentries when connecting, highest first.
+	annotationPriority = annotationPrefix + "priority"
+
+	// annotationNodeID is the ID the sentry must authenticate the privval
+	// connection with. Stock CometBFT uses a new privval key on every start,
+	// so it only works with sentries patched to use a stable key.
+	annotationNodeID = annotationPrefix + "node-id"
+
+	// annotationPortName is the name of the port to connect to the sentry pods
+	// on. Default the sentry-privval port of the Service, or the privval
+	// container port of CosmosFullNode pods.
+	annotationPortName = annotationPrefix + "port-name"
+)
+
+// sentryPrivvalPortName is the name of the Service port of cosmos-operator
+// sentries that the privval connection is made to.
+const sentryPrivvalPortName = "sentry-privval"
+
+const defaultDialTimeout = 2 * time.Second
+
+// sentryConfig is the configuration of the connection to a sentry.
+type sentryConfig struct {
+	chainIDs    []string
+	maxReadSize int
+	dialTimeout time.Duration
+	priority    int
+	nodeID      cometp2p.ID
+}
+
+// defaultSentryConfig returns the configuration of sentries without annotations.
+func defaultSentryConfig(maxReadSize int) sentryConfig {
+	return sentryConfig{
+		maxReadSize: maxReadSize,
+		dialTimeout: defaultDialTimeout,
+	}
+}
+
+// equal reports whether c configures the connection the same as other. The
+// priority is not compared, since it only orders new connections.
+func (c sentryConfig) equal(other sentryConfig) bool {
+	return equalStrings(c.chainIDs, other.chainIDs) &&
+		c.maxReadSize == other.maxReadSize &&
+		c.dialTimeout == other.dialTimeout &&
+		c.nodeID == other.nodeID
+}
+
+// newRemoteSigner returns a remote signer made by newSigner for the sentry
+// address configured by c and the additional options.
+func (c sentryConfig) newRemoteSigner(
+	newSigner SignerFactory,
+	address string,
+	logger cometlog.Logger,
+	hc signer.HorcruxConnection,
+	opts ...signer.ReconnRemoteSignerOption,
+) RemoteSigner {
+	if len(c.chainIDs) > 0 {
+		opts = append(opts, signer.ReconnRemoteSignerAllowedChainIDs(c.chainIDs...))
+	}
+	if c.nodeID != "" {
+		logger.Info("Sentry must authenticate with the node ID, which stock CometBFT does not support since it uses a new privval key on every start",
+			"address", address, "node_id", c.nodeID)
+		opts = append(opts, signer.ReconnRemoteSignerExpectedNodeID(c.nodeID))
+	}
+
+	dialer := net.Dialer{Timeout: c.dialTimeout}
+	return newSigner(address, logger, hc, dialer, c.maxReadSize, opts...)
+}
+
+// ignoreService reports whether the Service opted out of discovery.
+func ignoreService(annotations map[string]string) bool {
+	ignore, _ := strconv.ParseBool(annotations[annotationIgnore])
+	return ignore
+}
+
+// portName returns the name of the port to connect to the sentry pods on, set
+// by the annotations or the default.
+func portName(annotations map[string]string, defaultName string) (string, error) {
+	v, ok := annotations[annotationPortName]
+	if !ok {
+		return defaultName, nil
+	}
+	if v = strings.TrimSpace(v); v == "" {
+		return "", fmt.Errorf("invalid %s annotation %q", annotationPortName, annotations[annotationPortName])
+	}
+	return v, nil
+}
+
+// parseSentryConfig applies the annotations of a sentry Service to the defaults.
+func parseSentryConfig(annotations map[string]string, defaults sentryConfig) (sentryConfig, error) {
+	c := defaults
+
+	if v, ok := annotations[annotationChainIDs]; ok {
+		c.chainIDs = nil
+		for _, chainID := range strings.Split(v, ",") {
+			if chainID = strings.TrimSpace(chainID); chainID != "" {
+				c.chainIDs = append(c.chainIDs, chainID)
+			}
+		}
+		sort.Strings(c.chainIDs)
+	}
+
+	if v, ok := annotations[annotationMaxReadSize]; ok {
+		size, err := strconv.Atoi(v)
+		if err != nil || size <= 0 {
+			return c, fmt.Errorf("invalid %s annotation %q", annotationMaxReadSize, v)
+		}
+		c.maxReadSize = size
+	}
+
+	if v, ok := annotations[annotationDialTimeout]; ok {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			return c, fmt.Errorf("invalid %s annotation %q", annotationDialTimeout, v)
+		}
+		c.dialTimeout = timeout
+	}
+
+	if v, ok := annotations[annotationPriority]; ok {
+		priority, err := strconv.Atoi(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid %s annotation %q", annotationPriority, v)
+		}
+		c.priority = priority
+	}
+
+	if v, ok := annotations[annotationNodeID]; ok {
+		id, err := parseNodeID(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid %s annotation %q", annotationNodeID, v)
+		}
+		c.nodeID = id
+	}
+
+	return c, nil
+}
+
+// parseNodeID parses a p2p node ID, the hex encoded address of the node key.
+func parseNodeID(v string) (cometp2p.ID, error) {
+	id := strings.ToLower(strings.TrimSpace(v))
+	if bz, err := hex.DecodeString(id); err != nil || len(bz) != cometp2p.IDByteLength {
+		return "", fmt.Errorf("node ID must be %d hex encoded bytes", cometp2p.IDByteLength)
+	}
+	return cometp2p.ID(id), nil
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	cometp2p "github.com/cometbft/cometbft/p2p"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSentryConfig(t *testing.T) {
+	defaults := defaultSentryConfig(1024)
+	const nodeID = "A9B2C3D4E5F60718293A4B5C6D7E8F9012345678"
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        sentryConfig
+		wantErr     bool
+	}{
+		{name: "defaults", want: defaults},
+		{
+			name: "all annotations",
+			annotations: map[string]string{
+				annotationChainIDs:    "cosmoshub-4,,osmosis-1",
+				annotationMaxReadSize: "2048",
+				annotationDialTimeout: "5s",
+				annotationPriority:    "-1",
+				annotationNodeID:      nodeID,
+			},
+			want: sentryConfig{
+				chainIDs:    []string{"cosmoshub-4", "osmosis-1"},
+				maxReadSize: 2048,
+				dialTimeout: 5 * time.Second,
+				priority:    -1,
+				nodeID:      cometp2p.ID("a9b2c3d4e5f60718293a4b5c6d7e8f9012345678"),
+			},
+		},
+		{name: "invalid max read size", annotations: map[string]string{annotationMaxReadSize: "0"}, wantErr: true},
+		{name: "invalid dial timeout", annotations: map[string]string{annotationDialTimeout: "5"}, wantErr: true},
+		{name: "invalid priority", annotations: map[string]string{annotationPriority: "high"}, wantErr: true},
+		{name: "invalid node id", annotations: map[string]string{annotationNodeID: "abc"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseSentryConfig(tt.annotations, defaults)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, c)
+		})
+	}
+}
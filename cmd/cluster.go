@@ -0,0 +1,310 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// kubeCluster discovers sentries through the kube api of one cluster. The
+// local cluster, the one horcrux-proxy runs in or next to, has no name. The
+// sentries of other clusters are identified by their cluster name and address,
+// since pod IPs may overlap between clusters.
+type kubeCluster struct {
+	name      string
+	all       bool
+	client    kubernetes.Interface
+	discovery string
+	events    *sentryEvents
+	log       cometlog.Logger
+	selector  sentrySelector
+
+	// enqueue requests a reconcile of the SentryWatcher the cluster feeds.
+	enqueue func()
+
+	// readyGrace is how long a sentry pod must have been Ready before it is
+	// connected to. graceTimer requests a reconcile when the grace of the next
+	// pod has passed.
+	readyGrace time.Duration
+	graceTimer *time.Timer
+	graceAt    time.Time
+	now        func() time.Time
+
+	informers []namespaceInformers
+	nodes     informers.SharedInformerFactory
+	topology  topologySelector
+
+	// unowned are the addresses of the sentries that the shard assigns to
+	// other replicas, which are removed without the removal grace.
+	unownedMu sync.Mutex
+	unowned   map[string]bool
+
+	synced atomic.Bool
+}
+
+// namespaceInformers are the Service and Pod informers of a single namespace,
+// or of all namespaces if namespace is metav1.NamespaceAll. With CRD discovery,
+// the CosmosFullNode informer is used instead of the Service informer.
+type namespaceInformers struct {
+	namespace     string
+	factory       informers.SharedInformerFactory
+	serviceLister corelisters.ServiceLister
+	podLister     corelisters.PodLister
+
+	fullNodeFactory dynamicinformer.DynamicSharedInformerFactory
+	fullNodeLister  cache.GenericLister
+}
+
+// clusterKey qualifies a sentry address, namespace or Service key with the
+// cluster name. Keys of the local cluster are not qualified.
+func clusterKey(cluster, key string) string {
+	if cluster == "" {
+		return key
+	}
+	return cluster + "/" + key
+}
+
+// eventHandler returns the informer event handler that requests a reconcile.
+func (c *kubeCluster) eventHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(any) { c.enqueue() },
+		UpdateFunc: func(any, any) { c.enqueue() },
+		DeleteFunc: func(any) { c.enqueue() },
+	}
+}
+
+// setClient sets the kube client and registers the Service and Pod informers
+// of each namespace that trigger a reconcile whenever a sentry may have changed.
+// With CRD discovery, only the Pod informers are registered.
+func (c *kubeCluster) setClient(client kubernetes.Interface, namespaces []string) error {
+	c.client = client
+
+	handler := c.eventHandler()
+
+	for _, ns := range uniqueNamespaces(namespaces) {
+		factory := informers.NewSharedInformerFactoryWithOptions(client, resyncInterval, informers.WithNamespace(ns))
+
+		pods := factory.Core().V1().Pods()
+		if _, err := pods.Informer().AddEventHandler(handler); err != nil {
+			return fmt.Errorf("failed to add pod event handler: %w", err)
+		}
+
+		inf := namespaceInformers{
+			namespace: ns,
+			factory:   factory,
+			podLister: pods.Lister(),
+		}
+
+		// Services are not needed to discover sentries from CosmosFullNodes.
+		if c.discovery != DiscoveryCRD {
+			services := factory.Core().V1().Services()
+			if _, err := services.Informer().AddEventHandler(handler); err != nil {
+				return fmt.Errorf("failed to add service event handler: %w", err)
+			}
+			inf.serviceLister = services.Lister()
+		}
+
+		c.informers = append(c.informers, inf)
+	}
+
+	return nil
+}
+
+// setFullNodeClient switches discovery to CosmosFullNode resources, registering
+// a CosmosFullNode informer for each namespace of the informers set by setClient.
+func (c *kubeCluster) setFullNodeClient(client dynamic.Interface) error {
+	handler := c.eventHandler()
+
+	for i, inf := range c.informers {
+		factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, resyncInterval, inf.namespace, nil)
+		fullNodes := factory.ForResource(fullNodeGVR)
+
+		if _, err := fullNodes.Informer().AddEventHandler(handler); err != nil {
+			return fmt.Errorf("failed to add cosmosfullnode event handler: %w", err)
+		}
+
+		c.informers[i].fullNodeFactory = factory
+		c.informers[i].fullNodeLister = fullNodes.Lister()
+	}
+
+	return nil
+}
+
+// setTopology configures the topology domains used to select sentries when not
+// connecting to sentries on all nodes. Node labels are watched through a node
+// informer if topology keys are given.
+func (c *kubeCluster) setTopology(node string, keys []string) error {
+	c.topology = topologySelector{node: node, keys: keys}
+	if c.all || len(keys) == 0 {
+		return nil
+	}
+
+	c.nodes = informers.NewSharedInformerFactory(c.client, resyncInterval)
+	nodes := c.nodes.Core().V1().Nodes()
+
+	if _, err := nodes.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(any) { c.enqueue() },
+		UpdateFunc: func(oldObj, newObj any) {
+			// Nodes are updated frequently, only labels matter for topology.
+			if !labels.Equals(oldObj.(*corev1.Node).Labels, newObj.(*corev1.Node).Labels) {
+				c.enqueue()
+			}
+		},
+		DeleteFunc: func(any) { c.enqueue() },
+	}); err != nil {
+		return fmt.Errorf("failed to add node event handler: %w", err)
+	}
+
+	c.topology.nodeLister = nodes.Lister()
+
+	return nil
+}
+
+// startInformers starts the informers and waits for their caches to sync.
+func (c *kubeCluster) startInformers(stop <-chan struct{}) {
+	if c.nodes != nil {
+		c.nodes.Start(stop)
+		for typ, synced := range c.nodes.WaitForCacheSync(stop) {
+			if !synced {
+				c.log.Error("Failed to sync informer cache", "type", typ.String())
+			}
+		}
+	}
+	for _, inf := range c.informers {
+		if inf.fullNodeFactory != nil {
+			inf.fullNodeFactory.Start(stop)
+			for gvr, synced := range inf.fullNodeFactory.WaitForCacheSync(stop) {
+				if !synced {
+					c.log.Error("Failed to sync informer cache", "namespace", inf.namespace, "type", gvr.String())
+				}
+			}
+		}
+		inf.factory.Start(stop)
+		for typ, synced := range inf.factory.WaitForCacheSync(stop) {
+			if !synced {
+				c.log.Error("Failed to sync informer cache", "namespace", inf.namespace, "type", typ.String())
+			}
+		}
+	}
+	c.synced.Store(true)
+}
+
+// discover returns the privval endpoints of the sentries of the cluster, and
+// the errors keyed by the cluster qualified namespace or Service whose sentries
+// could not be listed. If none of the sentries of the cluster could be listed,
+// because its informers have not synced yet, available is false.
+func (c *kubeCluster) discover(defaults sentryConfig) (endpoints []sentryEndpoint, errs map[string]error, available bool) {
+	if !c.synced.Load() {
+		return nil, map[string]error{clusterKey(c.name, "cluster"): errors.New("informers have not synced yet")}, false
+	}
+
+	errs = make(map[string]error)
+
+	if c.graceTimer != nil {
+		c.graceTimer.Stop()
+		c.graceTimer = nil
+	}
+
+	for _, inf := range c.informers {
+		var found []sentryEndpoint
+		var infErrs map[string]error
+		if inf.fullNodeLister != nil {
+			found, infErrs = c.sentriesFromFullNodes(inf, defaults)
+		} else {
+			found, infErrs = c.sentriesInNamespace(inf, defaults)
+		}
+		for key, err := range infErrs {
+			errs[clusterKey(c.name, key)] = err
+		}
+		endpoints = append(endpoints, found...)
+	}
+
+	return endpoints, errs, true
+}
+
+// readyPods returns the pods that can be connected to: Running, Ready for at
+// least the ready grace and not being deleted. Pods that are being deleted are
+// left out, so their connections are torn down before the pods go away. If a
+// pod is Ready but still within the grace, a reconcile is scheduled for when
+// its grace has passed.
+func (c *kubeCluster) readyPods(pods []*corev1.Pod) []*corev1.Pod {
+	now := time.Now()
+	if c.now != nil {
+		now = c.now()
+	}
+
+	var ready []*corev1.Pod
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning || !podReady(pod) {
+			continue
+		}
+
+		if c.readyGrace > 0 {
+			if remaining := podReadySince(pod).Add(c.readyGrace).Sub(now); remaining > 0 {
+				c.scheduleReconcile(now, now.Add(remaining))
+				continue
+			}
+		}
+
+		ready = append(ready, pod)
+	}
+	return ready
+}
+
+// podGone reports whether the pod of a sentry no longer exists or is being
+// deleted. It is false if the pod is not watched.
+func (c *kubeCluster) podGone(e sentryEndpoint) bool {
+	for _, inf := range c.informers {
+		if inf.namespace != metav1.NamespaceAll && inf.namespace != e.namespace {
+			continue
+		}
+		pod, err := inf.podLister.Pods(e.namespace).Get(e.pod)
+		if err != nil {
+			return apierrors.IsNotFound(err)
+		}
+		return pod.UID != e.podUID || pod.DeletionTimestamp != nil
+	}
+	return false
+}
+
+// setUnowned records the addresses of the sentries of the cluster that the
+// shard assigns to other replicas.
+func (c *kubeCluster) setUnowned(unowned map[string]bool) {
+	c.unownedMu.Lock()
+	c.unowned = unowned
+	c.unownedMu.Unlock()
+}
+
+// shardDropped reports whether a sentry is assigned to another replica, or to
+// none while the shard lease of this replica is not live.
+func (c *kubeCluster) shardDropped(e sentryEndpoint) bool {
+	c.unownedMu.Lock()
+	defer c.unownedMu.Unlock()
+	return c.unowned[e.address]
+}
+
+// scheduleReconcile requests a reconcile at the time, unless one is scheduled earlier.
+func (c *kubeCluster) scheduleReconcile(now, at time.Time) {
+	if c.graceTimer != nil {
+		if !c.graceAt.After(at) {
+			return
+		}
+		c.graceTimer.Stop()
+	}
+	c.graceAt = at
+	c.graceTimer = time.AfterFunc(at.Sub(now), c.enqueue)
+}
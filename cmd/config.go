@@ -0,0 +1,704 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ConfigVersion is the version of the config file schema.
+	ConfigVersion = 1
+
+	// envPrefix prefixes the env vars of the start flags, e.g. HORCRUX_PROXY_LOG_LEVEL.
+	envPrefix = "HORCRUX_PROXY_"
+)
+
+// Config is the config file of the start command. Every setting has an
+// equivalent flag, except the per-sentry settings of Sentries. Flags and env
+// vars take precedence over the config file.
+type Config struct {
+	// Version of the schema, must be ConfigVersion.
+	Version int `json:"version"`
+
+	Log       LogConfig       `json:"log"`
+	Horcrux   HorcruxConfig   `json:"horcrux"`
+	Sentries  []StaticSentry  `json:"sentries,omitempty"`
+	Discovery DiscoveryConfig `json:"discovery"`
+	Timeouts  TimeoutsConfig  `json:"timeouts"`
+	Admin     AdminConfig     `json:"admin"`
+
+	// MaxReadSize is the default max read size of privval messages in bytes.
+	MaxReadSize int `json:"maxReadSize,omitempty"`
+}
+
+// LogConfig configures logging.
+type LogConfig struct {
+	Level string `json:"level,omitempty"`
+}
+
+// HorcruxConfig configures the connection(s) to horcrux.
+type HorcruxConfig struct {
+	GRPC           string   `json:"grpc,omitempty"`
+	Listen         []string `json:"listen,omitempty"`
+	Primary        string   `json:"primary,omitempty"`
+	ListenMaxConns int      `json:"listenMaxConns,omitempty"`
+	UnixAllowUIDs  []uint   `json:"unixAllowUIDs,omitempty"`
+	UnixAllowGIDs  []uint   `json:"unixAllowGIDs,omitempty"`
+	UnixSocketMode string   `json:"unixSocketMode,omitempty"`
+}
+
+// DiscoveryConfig configures the discovery of sentries through the kube api,
+// DNS, sentry files and a sentry URL.
+type DiscoveryConfig struct {
+	// Operator enables discovery in the local cluster. Default true.
+	Operator *bool `json:"operator,omitempty"`
+
+	// Mode is DiscoveryLabels or DiscoveryCRD.
+	Mode string `json:"mode,omitempty"`
+
+	All            bool     `json:"all,omitempty"`
+	Labels         []string `json:"labels,omitempty"`
+	LabelGroups    []string `json:"labelGroups,omitempty"`
+	ExcludeLabels  []string `json:"excludeLabels,omitempty"`
+	NoDefaultLabel bool     `json:"noDefaultLabel,omitempty"`
+
+	Kubeconfig    string   `json:"kubeconfig,omitempty"`
+	Context       string   `json:"context,omitempty"`
+	Node          string   `json:"node,omitempty"`
+	TopologyKeys  []string `json:"topologyKeys,omitempty"`
+	Namespaces    []string `json:"namespaces,omitempty"`
+	AllNamespaces bool     `json:"allNamespaces,omitempty"`
+	ReadyGrace    Duration `json:"readyGrace,omitempty"`
+	RemovalGrace  Duration `json:"removalGrace,omitempty"`
+
+	Clusters []ClusterConfig `json:"clusters,omitempty"`
+	Shard    ShardConfig     `json:"shard"`
+
+	DNS   DNSConfig   `json:"dns"`
+	Files FilesConfig `json:"files"`
+	HTTP  HTTPConfig  `json:"http"`
+}
+
+// ClusterConfig configures sentry discovery in another cluster.
+type ClusterConfig struct {
+	Name       string   `json:"name"`
+	Kubeconfig string   `json:"kubeconfig"`
+	Context    string   `json:"context,omitempty"`
+	Labels     []string `json:"labels,omitempty"`
+}
+
+// ShardConfig configures sharding of sentries across proxy replicas.
+type ShardConfig struct {
+	Group         string   `json:"group,omitempty"`
+	Identity      string   `json:"identity,omitempty"`
+	LeaseDuration Duration `json:"leaseDuration,omitempty"`
+}
+
+// DNSConfig configures sentry discovery through DNS.
+type DNSConfig struct {
+	// Sentries are HOST:PORT names whose A/AAAA records are sentries.
+	Sentries []string `json:"sentries,omitempty"`
+	// SRV are names whose SRV records point to sentries.
+	SRV      []string `json:"srv,omitempty"`
+	Interval Duration `json:"interval,omitempty"`
+	Server   string   `json:"server,omitempty"`
+}
+
+// FilesConfig configures sentry discovery through sentry files.
+type FilesConfig struct {
+	Paths    []string `json:"paths,omitempty"`
+	Interval Duration `json:"interval,omitempty"`
+}
+
+// HTTPConfig configures sentry discovery through an HTTP endpoint.
+type HTTPConfig struct {
+	URL        string   `json:"url,omitempty"`
+	Interval   Duration `json:"interval,omitempty"`
+	AuthHeader string   `json:"authHeader,omitempty"`
+	AuthFile   string   `json:"authFile,omitempty"`
+
+	TLS HTTPTLSConfig `json:"tls"`
+}
+
+// HTTPTLSConfig configures the TLS connection to the sentry URL.
+type HTTPTLSConfig struct {
+	CA                 string `json:"ca,omitempty"`
+	Cert               string `json:"cert,omitempty"`
+	Key                string `json:"key,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+}
+
+// AdminConfig configures the admin API.
+type AdminConfig struct {
+	Address   string `json:"address,omitempty"`
+	TokenFile string `json:"tokenFile,omitempty"`
+}
+
+// TimeoutsConfig configures timeouts.
+type TimeoutsConfig struct {
+	// Dial is the default timeout for dialing sentries.
+	Dial Duration `json:"dial,omitempty"`
+}
+
+// StaticSentry is a sentry that is always connected to, from --sentry or the
+// sentries of the config file. Zero settings default to those of discovered
+// sentries.
+type StaticSentry struct {
+	Address     string   `json:"address"`
+	ChainIDs    []string `json:"chainIDs,omitempty"`
+	MaxReadSize int      `json:"maxReadSize,omitempty"`
+	DialTimeout Duration `json:"dialTimeout,omitempty"`
+	NodeID      string   `json:"nodeID,omitempty"`
+}
+
+// config applies the settings of the sentry to the defaults.
+func (s StaticSentry) config(defaults sentryConfig) (sentryConfig, error) {
+	c := defaults
+
+	if len(s.ChainIDs) > 0 {
+		c.chainIDs = nil
+		for _, chainID := range s.ChainIDs {
+			if chainID = strings.TrimSpace(chainID); chainID != "" {
+				c.chainIDs = append(c.chainIDs, chainID)
+			}
+		}
+		sort.Strings(c.chainIDs)
+	}
+
+	if s.MaxReadSize < 0 {
+		return c, fmt.Errorf("invalid maxReadSize %d", s.MaxReadSize)
+	}
+	if s.MaxReadSize > 0 {
+		c.maxReadSize = s.MaxReadSize
+	}
+
+	if s.DialTimeout < 0 {
+		return c, fmt.Errorf("invalid dialTimeout %s", s.DialTimeout)
+	}
+	if s.DialTimeout > 0 {
+		c.dialTimeout = time.Duration(s.DialTimeout)
+	}
+
+	if s.NodeID != "" {
+		id, err := parseNodeID(s.NodeID)
+		if err != nil {
+			return c, fmt.Errorf("invalid nodeID %q: %w", s.NodeID, err)
+		}
+		c.nodeID = id
+	}
+
+	return c, nil
+}
+
+// Duration is a time.Duration written as a string in config files, e.g. "5s".
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string, e.g. \"5s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// LoadConfig reads the config file at path. The format is YAML (.yaml, .yml or
+// .json) or TOML (.toml) by file extension. Unknown fields are an error, so a
+// typo in a setting is not silently ignored.
+func LoadConfig(path string) (Config, error) {
+	bz, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var jsonBz []byte
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml", ".json":
+		jsonBz, err = yaml.YAMLToJSON(bz)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse yaml config: %w", err)
+		}
+	case ".toml":
+		var m map[string]any
+		if err := toml.Unmarshal(bz, &m); err != nil {
+			return Config{}, fmt.Errorf("failed to parse toml config: %w", err)
+		}
+		jsonBz, err = json.Marshal(m)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to convert toml config: %w", err)
+		}
+	default:
+		return Config{}, fmt.Errorf("unsupported config file extension %q, must be .yaml, .yml, .json or .toml", ext)
+	}
+
+	var c Config
+	if err := decodeStrict(jsonBz, &c); err != nil {
+		return Config{}, fmt.Errorf("failed to decode config: %w", err)
+	}
+
+	return c, nil
+}
+
+// decodeStrict decodes JSON into v. Unknown fields are an error.
+func decodeStrict(jsonBz []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(jsonBz))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// Validate returns all the problems of the config joined together, or nil.
+func (c Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.Version != ConfigVersion {
+		add("unsupported version %d, must be %d", c.Version, ConfigVersion)
+	}
+
+	if c.Log.Level != "" {
+		if _, err := cometlog.AllowLevel(c.Log.Level); err != nil {
+			add("invalid log.level: %w", err)
+		}
+	}
+
+	h := c.Horcrux
+	if h.Primary != "" && h.Primary != pathGRPC && h.Primary != pathListen {
+		add("invalid horcrux.primary %q, must be %q or %q", h.Primary, pathGRPC, pathListen)
+	}
+	if h.ListenMaxConns < 0 {
+		add("invalid horcrux.listenMaxConns %d", h.ListenMaxConns)
+	}
+	if h.UnixSocketMode != "" {
+		if _, err := strconv.ParseUint(h.UnixSocketMode, 8, 32); err != nil {
+			add("invalid horcrux.unixSocketMode %q, must be octal", h.UnixSocketMode)
+		}
+	}
+
+	if c.MaxReadSize < 0 {
+		add("invalid maxReadSize %d", c.MaxReadSize)
+	}
+	if c.Timeouts.Dial < 0 {
+		add("invalid timeouts.dial %s", c.Timeouts.Dial)
+	}
+
+	admin := AdminOptions{Address: c.Admin.Address, TokenFile: c.Admin.TokenFile}
+	if err := admin.validate(); err != nil {
+		add("invalid admin: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for i, s := range c.Sentries {
+		if s.Address == "" {
+			add("sentries[%d]: address is required", i)
+			continue
+		}
+		if seen[s.Address] {
+			add("sentries[%d]: duplicate address %q", i, s.Address)
+		}
+		seen[s.Address] = true
+		if _, err := s.config(sentryConfig{}); err != nil {
+			add("sentries[%d]: %w", i, err)
+		}
+	}
+
+	d := c.Discovery
+	if d.Mode != "" && d.Mode != DiscoveryLabels && d.Mode != DiscoveryCRD {
+		add("invalid discovery.mode %q, must be %s or %s", d.Mode, DiscoveryLabels, DiscoveryCRD)
+	}
+	if _, err := newSentrySelector(d.Labels, d.selectorOptions()); err != nil {
+		add("invalid discovery labels: %w", err)
+	}
+	if d.ReadyGrace < 0 {
+		add("invalid discovery.readyGrace %s", d.ReadyGrace)
+	}
+	if d.RemovalGrace < 0 {
+		add("invalid discovery.removalGrace %s", d.RemovalGrace)
+	}
+	if d.Shard.LeaseDuration < 0 {
+		add("invalid discovery.shard.leaseDuration %s", d.Shard.LeaseDuration)
+	}
+
+	clusterNames := make(map[string]bool)
+	for i, cluster := range d.Clusters {
+		if cluster.Name == "" || cluster.Kubeconfig == "" {
+			add("discovery.clusters[%d]: name and kubeconfig are required", i)
+		}
+		if clusterNames[cluster.Name] {
+			add("discovery.clusters[%d]: duplicate name %q", i, cluster.Name)
+		}
+		clusterNames[cluster.Name] = true
+		if _, err := newSentrySelector(cluster.Labels, d.selectorOptions()); err != nil {
+			add("discovery.clusters[%d]: invalid labels: %w", i, err)
+		}
+	}
+
+	dns := DNSOptions{Names: d.DNS.Sentries, SRV: d.DNS.SRV, Interval: time.Duration(d.DNS.Interval), Server: d.DNS.Server}
+	if err := dns.validate(); err != nil {
+		add("invalid discovery.dns: %w", err)
+	}
+	files := FileOptions{Paths: d.Files.Paths, Interval: time.Duration(d.Files.Interval)}
+	if err := files.validate(); err != nil {
+		add("invalid discovery.files: %w", err)
+	}
+	httpOpts := HTTPOptions{
+		URL:      d.HTTP.URL,
+		Interval: time.Duration(d.HTTP.Interval),
+		CertFile: d.HTTP.TLS.Cert,
+		KeyFile:  d.HTTP.TLS.Key,
+	}
+	if err := httpOpts.validate(); err != nil {
+		add("invalid discovery.http: %w", err)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (d DiscoveryConfig) selectorOptions() SelectorOptions {
+	return SelectorOptions{
+		Groups:    d.LabelGroups,
+		Excludes:  d.ExcludeLabels,
+		NoDefault: d.NoDefaultLabel,
+	}
+}
+
+// flagValues returns the values of the start flags that the config sets, keyed
+// by flag name. Repeatable flags have a value per repetition.
+func (c Config) flagValues() map[string][]string {
+	v := make(map[string][]string)
+	setString := func(flag, s string) {
+		if s != "" {
+			v[flag] = []string{s}
+		}
+	}
+	setStrings := func(flag string, s []string) {
+		if len(s) > 0 {
+			v[flag] = s
+		}
+	}
+	setBool := func(flag string, b bool) {
+		if b {
+			v[flag] = []string{"true"}
+		}
+	}
+	setInt := func(flag string, i int) {
+		if i != 0 {
+			v[flag] = []string{strconv.Itoa(i)}
+		}
+	}
+	setDuration := func(flag string, d Duration) {
+		if d != 0 {
+			v[flag] = []string{d.String()}
+		}
+	}
+	setUints := func(flag string, u []uint) {
+		for _, id := range u {
+			v[flag] = append(v[flag], strconv.FormatUint(uint64(id), 10))
+		}
+	}
+
+	setString(flagLogLevel, c.Log.Level)
+
+	setString(flagGRPCAddress, c.Horcrux.GRPC)
+	setStrings(flagListen, c.Horcrux.Listen)
+	setString(flagPrimary, c.Horcrux.Primary)
+	setInt(flagListenMaxConns, c.Horcrux.ListenMaxConns)
+	setUints(flagUnixAllowUID, c.Horcrux.UnixAllowUIDs)
+	setUints(flagUnixAllowGID, c.Horcrux.UnixAllowGIDs)
+	setString(flagUnixSocketMode, c.Horcrux.UnixSocketMode)
+
+	setInt(flagMaxReadSize, c.MaxReadSize)
+	setDuration(flagDialTimeout, c.Timeouts.Dial)
+
+	setString(flagAdminAddress, c.Admin.Address)
+	setString(flagAdminTokenFile, c.Admin.TokenFile)
+
+	d := c.Discovery
+	if d.Operator != nil {
+		v[flagOperator] = []string{strconv.FormatBool(*d.Operator)}
+	}
+	setString(flagDiscovery, d.Mode)
+	setBool(flagAll, d.All)
+	setStrings(flagSentryLabel, d.Labels)
+	setStrings(flagLabelGroup, d.LabelGroups)
+	setStrings(flagExclude, d.ExcludeLabels)
+	setBool(flagNoDefault, d.NoDefaultLabel)
+	setString(flagKubeconfig, d.Kubeconfig)
+	setString(flagKubeContext, d.Context)
+	setString(flagNode, d.Node)
+	setStrings(flagTopologyKey, d.TopologyKeys)
+	setStrings(flagNamespace, d.Namespaces)
+	setBool(flagAllNamespaces, d.AllNamespaces)
+	setDuration(flagReadyGrace, d.ReadyGrace)
+	setDuration(flagRemovalGrace, d.RemovalGrace)
+
+	for _, cluster := range d.Clusters {
+		v[flagCluster] = append(v[flagCluster], cluster.Name+"="+cluster.Kubeconfig)
+		if cluster.Context != "" {
+			v[flagClusterContext] = append(v[flagClusterContext], cluster.Name+"="+cluster.Context)
+		}
+		for _, label := range cluster.Labels {
+			v[flagClusterLabel] = append(v[flagClusterLabel], cluster.Name+"="+label)
+		}
+	}
+
+	setString(flagShardGroup, d.Shard.Group)
+	setString(flagShardIdentity, d.Shard.Identity)
+	setDuration(flagShardLeaseDuration, d.Shard.LeaseDuration)
+
+	setStrings(flagDNSSentry, d.DNS.Sentries)
+	setStrings(flagDNSSRV, d.DNS.SRV)
+	setDuration(flagDNSInterval, d.DNS.Interval)
+	setString(flagDNSServer, d.DNS.Server)
+
+	setStrings(flagSentryFile, d.Files.Paths)
+	setDuration(flagSentryFileInterval, d.Files.Interval)
+
+	setString(flagSentryURL, d.HTTP.URL)
+	setDuration(flagSentryURLInterval, d.HTTP.Interval)
+	setString(flagSentryURLAuthHeader, d.HTTP.AuthHeader)
+	setString(flagSentryURLAuthFile, d.HTTP.AuthFile)
+	setString(flagSentryURLCA, d.HTTP.TLS.CA)
+	setString(flagSentryURLCert, d.HTTP.TLS.Cert)
+	setString(flagSentryURLKey, d.HTTP.TLS.Key)
+	setBool(flagSentryURLInsecureSkipTLS, d.HTTP.TLS.InsecureSkipVerify)
+
+	return v
+}
+
+// configFlagGroups are flags that only make sense together. If any flag of a
+// group is set, the config values of the whole group are ignored.
+var configFlagGroups = [][]string{
+	{flagCluster, flagClusterContext, flagClusterLabel},
+	{flagNamespace, flagAllNamespaces},
+}
+
+// envName returns the env var of a flag, e.g. HORCRUX_PROXY_LOG_LEVEL for --log-level.
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// applyEnv sets the flags that were not set on the command line from their env
+// vars. The values of repeatable flags are separated by ";".
+func applyEnv(flags *pflag.FlagSet) error {
+	var errs []error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Changed {
+			return
+		}
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		values := []string{value}
+		if f.Value.Type() == "stringArray" {
+			values = strings.Split(value, ";")
+		}
+		for _, v := range values {
+			if err := flags.Set(f.Name, v); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s: %w", envName(f.Name), err))
+				return
+			}
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// configSource is the config file of the start command and the flags that
+// override it, set on the command line or by env var. It resolves the settings
+// of the config file, also when the config file is reloaded.
+type configSource struct {
+	path      string
+	overrides map[string]bool
+
+	// sentries are those of --sentry.
+	sentries []StaticSentry
+
+	// logLevel is that of --log-level, or its default.
+	logLevel string
+}
+
+// newConfigSource applies the env vars to the flags that were not set on the
+// command line, and returns the configSource of the flags.
+func newConfigSource(flags *pflag.FlagSet) (configSource, error) {
+	if err := applyEnv(flags); err != nil {
+		return configSource{}, err
+	}
+
+	s := configSource{overrides: make(map[string]bool)}
+	flags.Visit(func(f *pflag.Flag) {
+		s.overrides[f.Name] = true
+	})
+
+	s.path, _ = flags.GetString(flagConfig)
+	s.logLevel, _ = flags.GetString(flagLogLevel)
+
+	addresses, _ := flags.GetStringArray(flagSentry)
+	for _, address := range addresses {
+		s.sentries = append(s.sentries, StaticSentry{Address: address})
+	}
+
+	return s, nil
+}
+
+// load reads and validates the config file.
+func (s configSource) load() (Config, error) {
+	c, err := LoadConfig(s.path)
+	if err != nil {
+		return Config{}, err
+	}
+	if err := c.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid config %s: %w", s.path, err)
+	}
+	return c, nil
+}
+
+// overridden reports whether the config value of the flag is overridden, by
+// the flag itself or by another flag of its group.
+func (s configSource) overridden(flag string) bool {
+	if s.overrides[flag] {
+		return true
+	}
+	for _, group := range configFlagGroups {
+		for _, f := range group {
+			if f != flag {
+				continue
+			}
+			for _, other := range group {
+				if s.overrides[other] {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// staticSentries returns the sentries of --sentry if set, otherwise those of
+// the config.
+func (s configSource) staticSentries(c Config) []StaticSentry {
+	if s.overrides[flagSentry] {
+		return s.sentries
+	}
+	return c.Sentries
+}
+
+// level returns the log level of --log-level if set, otherwise that of the
+// config or the default.
+func (s configSource) level(c Config) string {
+	if !s.overrides[flagLogLevel] && c.Log.Level != "" {
+		return c.Log.Level
+	}
+	return s.logLevel
+}
+
+// restartRequired returns the sorted flags whose config values differ between
+// the configs and that are not overridden. Changes to them only take effect
+// after a restart.
+func (s configSource) restartRequired(old, c Config) []string {
+	oldValues, values := old.flagValues(), c.flagValues()
+	for flag := range oldValues {
+		if _, ok := values[flag]; !ok {
+			values[flag] = nil
+		}
+	}
+
+	var flags []string
+	for flag, v := range values {
+		if flag == flagLogLevel || s.overridden(flag) {
+			continue
+		}
+		if !equalStrings(oldValues[flag], v) {
+			flags = append(flags, flag)
+		}
+	}
+	sort.Strings(flags)
+	return flags
+}
+
+// applyConfig applies the env vars and then the config file, if any, to the
+// flags that were not set on the command line. It returns the configSource of
+// the flags and the config.
+func applyConfig(flags *pflag.FlagSet) (configSource, Config, error) {
+	s, err := newConfigSource(flags)
+	if err != nil {
+		return configSource{}, Config{}, err
+	}
+	if s.path == "" {
+		return s, Config{}, nil
+	}
+
+	c, err := s.load()
+	if err != nil {
+		return configSource{}, Config{}, err
+	}
+
+	for flag, values := range c.flagValues() {
+		if s.overridden(flag) {
+			continue
+		}
+		for _, v := range values {
+			if err := flags.Set(flag, v); err != nil {
+				return configSource{}, Config{}, fmt.Errorf("invalid config value for --%s: %w", flag, err)
+			}
+		}
+	}
+
+	return s, c, nil
+}
+
+func configCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Config file commands",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "validate FILE",
+		Short:        "Validate a config file of the start command",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := LoadConfig(args[0])
+			if err != nil {
+				return err
+			}
+			if err := c.Validate(); err != nil {
+				return fmt.Errorf("invalid config %s: %w", args[0], err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s is a valid version %d config\n", args[0], c.Version)
+			return nil
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testConfigYAML = `
+version: 1
+log:
+  level: debug
+horcrux:
+  grpc: horcrux:7070
+  listen: ["tcp://0.0.0.0:1234"]
+  primary: listen
+sentries:
+  - address: tcp://sentry-a:1234
+    chainIDs: [cosmoshub-4]
+    dialTimeout: 5s
+  - address: tcp://sentry-b:1234
+discovery:
+  operator: false
+  labels: ["team=a"]
+  namespaces: [sentries]
+  readyGrace: 30s
+  clusters:
+    - name: east
+      kubeconfig: /etc/east.yaml
+      labels: ["region=east"]
+  shard:
+    group: proxies
+timeouts:
+  dial: 3s
+maxReadSize: 2048
+`
+
+const testConfigTOML = `
+version = 1
+maxReadSize = 2048
+
+[log]
+level = "debug"
+
+[horcrux]
+grpc = "horcrux:7070"
+listen = ["tcp://0.0.0.0:1234"]
+primary = "listen"
+
+[[sentries]]
+address = "tcp://sentry-a:1234"
+chainIDs = ["cosmoshub-4"]
+dialTimeout = "5s"
+
+[[sentries]]
+address = "tcp://sentry-b:1234"
+
+[discovery]
+operator = false
+labels = ["team=a"]
+namespaces = ["sentries"]
+readyGrace = "30s"
+
+[[discovery.clusters]]
+name = "east"
+kubeconfig = "/etc/east.yaml"
+labels = ["region=east"]
+
+[discovery.shard]
+group = "proxies"
+
+[timeouts]
+dial = "3s"
+`
+
+func writeConfig(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	operator := false
+	want := Config{
+		Version: 1,
+		Log:     LogConfig{Level: "debug"},
+		Horcrux: HorcruxConfig{
+			GRPC:    "horcrux:7070",
+			Listen:  []string{"tcp://0.0.0.0:1234"},
+			Primary: "listen",
+		},
+		Sentries: []StaticSentry{
+			{Address: "tcp://sentry-a:1234", ChainIDs: []string{"cosmoshub-4"}, DialTimeout: Duration(5 * time.Second)},
+			{Address: "tcp://sentry-b:1234"},
+		},
+		Discovery: DiscoveryConfig{
+			Operator:   &operator,
+			Labels:     []string{"team=a"},
+			Namespaces: []string{"sentries"},
+			ReadyGrace: Duration(30 * time.Second),
+			Clusters: []ClusterConfig{
+				{Name: "east", Kubeconfig: "/etc/east.yaml", Labels: []string{"region=east"}},
+			},
+			Shard: ShardConfig{Group: "proxies"},
+		},
+		Timeouts:    TimeoutsConfig{Dial: Duration(3 * time.Second)},
+		MaxReadSize: 2048,
+	}
+
+	for _, path := range []string{
+		writeConfig(t, "config.yaml", testConfigYAML),
+		writeConfig(t, "config.toml", testConfigTOML),
+	} {
+		c, err := LoadConfig(path)
+		require.NoError(t, err, path)
+		require.Equal(t, want, c, path)
+		require.NoError(t, c.Validate(), path)
+	}
+
+	_, err := LoadConfig(writeConfig(t, "config.yaml", "version: 1\nsentreis: []\n"))
+	require.ErrorContains(t, err, "unknown field")
+
+	_, err = LoadConfig(writeConfig(t, "config.yaml", "version: 1\ntimeouts:\n  dial: 5\n"))
+	require.Error(t, err)
+
+	_, err = LoadConfig(writeConfig(t, "config.ini", "version = 1"))
+	require.ErrorContains(t, err, "unsupported config file extension")
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{name: "minimal", config: Config{Version: 1}},
+		{name: "missing version", config: Config{}, wantErr: "unsupported version 0"},
+		{name: "future version", config: Config{Version: 2}, wantErr: "unsupported version 2"},
+		{name: "log level", config: Config{Version: 1, Log: LogConfig{Level: "loud"}}, wantErr: "log.level"},
+		{name: "primary", config: Config{Version: 1, Horcrux: HorcruxConfig{Primary: "raft"}}, wantErr: "horcrux.primary"},
+		{name: "socket mode", config: Config{Version: 1, Horcrux: HorcruxConfig{UnixSocketMode: "rw"}}, wantErr: "horcrux.unixSocketMode"},
+		{
+			name:    "sentry without address",
+			config:  Config{Version: 1, Sentries: []StaticSentry{{ChainIDs: []string{"a"}}}},
+			wantErr: "sentries[0]: address is required",
+		},
+		{
+			name:    "duplicate sentry",
+			config:  Config{Version: 1, Sentries: []StaticSentry{{Address: "tcp://a:1234"}, {Address: "tcp://a:1234"}}},
+			wantErr: "sentries[1]: duplicate address",
+		},
+		{
+			name:    "sentry node id",
+			config:  Config{Version: 1, Sentries: []StaticSentry{{Address: "tcp://a:1234", NodeID: "abc"}}},
+			wantErr: "sentries[0]: invalid nodeID",
+		},
+		{name: "discovery mode", config: Config{Version: 1, Discovery: DiscoveryConfig{Mode: "dns"}}, wantErr: "discovery.mode"},
+		{
+			name:    "label selector",
+			config:  Config{Version: 1, Discovery: DiscoveryConfig{ExcludeLabels: []string{"tier in (a"}}},
+			wantErr: "invalid discovery labels",
+		},
+		{
+			name: "duplicate cluster",
+			config: Config{Version: 1, Discovery: DiscoveryConfig{Clusters: []ClusterConfig{
+				{Name: "east", Kubeconfig: "a"},
+				{Name: "east", Kubeconfig: "b"},
+			}}},
+			wantErr: "discovery.clusters[1]: duplicate name",
+		},
+		{
+			name:    "dns sentry",
+			config:  Config{Version: 1, Discovery: DiscoveryConfig{DNS: DNSConfig{Sentries: []string{"sentries.example.com"}}}},
+			wantErr: "invalid discovery.dns",
+		},
+		{
+			name:    "negative duration",
+			config:  Config{Version: 1, Timeouts: TimeoutsConfig{Dial: Duration(-time.Second)}},
+			wantErr: "timeouts.dial",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	path := writeConfig(t, "config.yaml", testConfigYAML)
+
+	cmd := startCmd()
+	require.NoError(t, cmd.ParseFlags([]string{
+		"--config", path,
+		"--log-level", "error",
+		"--namespace", "flags",
+	}))
+	t.Setenv(envName(flagLogLevel), "info")
+	t.Setenv(envName(flagGRPCAddress), "env:7070")
+	t.Setenv(envName(flagTopologyKey), "topology.kubernetes.io/zone;topology.kubernetes.io/region")
+
+	source, c, err := applyConfig(cmd.Flags())
+	require.NoError(t, err)
+	sentries := source.staticSentries(c)
+
+	flags := cmd.Flags()
+	get := func(name string) string {
+		return flags.Lookup(name).Value.String()
+	}
+
+	// flags take precedence over env vars and the config
+	require.Equal(t, "error", get(flagLogLevel))
+	// env vars take precedence over the config
+	require.Equal(t, "env:7070", get(flagGRPCAddress))
+	topologyKeys, _ := flags.GetStringArray(flagTopologyKey)
+	require.Equal(t, []string{"topology.kubernetes.io/zone", "topology.kubernetes.io/region"}, topologyKeys)
+	// the config takes precedence over defaults
+	require.Equal(t, "listen", get(flagPrimary))
+	require.Equal(t, "false", get(flagOperator))
+	require.Equal(t, "2048", get(flagMaxReadSize))
+	require.Equal(t, "3s", get(flagDialTimeout))
+	require.Equal(t, "30s", get(flagReadyGrace))
+	clusters, err := clusterOptions(cmd)
+	require.NoError(t, err)
+	require.Equal(t, []ClusterOptions{{Name: "east", Kubeconfig: "/etc/east.yaml", Labels: []string{"region=east"}}}, clusters)
+	// defaults are kept if neither is set
+	require.Equal(t, "false", get(flagAll))
+	// the config namespaces are ignored since --namespace is set
+	namespaces, _ := flags.GetStringArray(flagNamespace)
+	require.Equal(t, []string{"flags"}, namespaces)
+
+	require.Len(t, sentries, 2)
+	require.Equal(t, "tcp://sentry-a:1234", sentries[0].Address)
+
+	// --sentry replaces the sentries of the config
+	cmd = startCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--config", path, "--sentry", "tcp://flag:1234"}))
+	source, c, err = applyConfig(cmd.Flags())
+	require.NoError(t, err)
+	sentries = source.staticSentries(c)
+	require.Equal(t, []StaticSentry{{Address: "tcp://flag:1234"}}, sentries)
+
+	// an invalid config fails fast
+	cmd = startCmd()
+	require.NoError(t, cmd.ParseFlags([]string{"--config", writeConfig(t, "bad.yaml", "version: 2\n")}))
+	_, _, err = applyConfig(cmd.Flags())
+	require.ErrorContains(t, err, "unsupported version")
+}
@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+)
+
+// DefaultDNSInterval is how often the DNS names of sentries are resolved.
+const DefaultDNSInterval = 30 * time.Second
+
+// DNSOptions configure sentry discovery through DNS, for sentries outside of
+// kubernetes that sit behind DNS names with several records.
+type DNSOptions struct {
+	// Names are HOST:PORT names. Each A/AAAA record of HOST is a sentry on PORT.
+	Names []string
+
+	// SRV are names of SRV records. Each A/AAAA record of the target of each
+	// SRV record is a sentry on the port of the SRV record.
+	SRV []string
+
+	// Interval is how often the names are resolved. Defaults to
+	// DefaultDNSInterval.
+	Interval time.Duration
+
+	// Server is the HOST:PORT of the DNS server to query instead of the
+	// servers of the system resolver.
+	Server string
+}
+
+// enabled reports whether any names are configured.
+func (o DNSOptions) enabled() bool {
+	return len(o.Names) > 0 || len(o.SRV) > 0
+}
+
+// validate returns an error if any of the options is invalid.
+func (o DNSOptions) validate() error {
+	var errs []error
+	for _, name := range o.Names {
+		host, port, err := net.SplitHostPort(name)
+		if err == nil && host != "" {
+			_, err = strconv.ParseUint(port, 10, 16)
+		}
+		if err != nil || host == "" {
+			errs = append(errs, fmt.Errorf("invalid DNS sentry %q, must be HOST:PORT", name))
+		}
+	}
+	for _, name := range o.SRV {
+		if name == "" {
+			errs = append(errs, errors.New("empty DNS SRV name"))
+		}
+	}
+	if o.Interval < 0 {
+		errs = append(errs, fmt.Errorf("invalid DNS interval %s", o.Interval))
+	}
+	if o.Server != "" {
+		if _, _, err := net.SplitHostPort(o.Server); err != nil {
+			errs = append(errs, fmt.Errorf("invalid DNS server %q, must be HOST:PORT", o.Server))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// resolver returns the resolver that queries the DNS server of the options.
+func (o DNSOptions) resolver() *net.Resolver {
+	if o.Server == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, o.Server)
+		},
+	}
+}
+
+// dnsDiscovery is the Discoverer of the sentries at the addresses that the DNS
+// names of sentries resolve to, which it resolves at an interval. If a name
+// can't be resolved, its previously resolved sentries are kept, unless the
+// name does not exist.
+type dnsDiscovery struct {
+	opts     DNSOptions
+	resolver *net.Resolver
+	defaults sentryConfig
+	log      cometlog.Logger
+
+	// resolved are the sentry addresses of each name.
+	resolved map[string][]string
+}
+
+var _ Discoverer = (*dnsDiscovery)(nil)
+
+// newDNSDiscovery returns a dnsDiscovery of the options, that configures the
+// sentries by defaults.
+func newDNSDiscovery(
+	opts DNSOptions,
+	defaults sentryConfig,
+	logger cometlog.Logger,
+) (*dnsDiscovery, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if opts.Interval == 0 {
+		opts.Interval = DefaultDNSInterval
+	}
+	return &dnsDiscovery{
+		opts:     opts,
+		resolver: opts.resolver(),
+		defaults: defaults,
+		log:      logger,
+		resolved: make(map[string][]string),
+	}, nil
+}
+
+// Name implements Discoverer.
+func (d *dnsDiscovery) Name() string {
+	return sourceDNS
+}
+
+// Run implements Discoverer. It resolves the names right away, and then at the
+// interval until stop is closed.
+func (d *dnsDiscovery) Run(ctx context.Context, stop <-chan struct{}, update SentryUpdate) {
+	ticker := time.NewTicker(d.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		d.refresh(ctx)
+		if err := (ReconcileResult{Errors: update(desiredSentries(d.configs(), d.log))}).Err(); err != nil {
+			d.log.Error("Failed to update DNS sentries", "error", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh resolves the names.
+func (d *dnsDiscovery) refresh(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, d.opts.Interval)
+	defer cancel()
+
+	for _, name := range d.opts.Names {
+		host, port, _ := net.SplitHostPort(name)
+		addresses, err := d.lookup(ctx, host, port)
+		d.update(name, addresses, err)
+	}
+	for _, name := range d.opts.SRV {
+		addresses, err := d.lookupSRV(ctx, name)
+		d.update(name, addresses, err)
+	}
+}
+
+// configs returns the configs of the resolved sentries, keyed by address.
+func (d *dnsDiscovery) configs() map[string]sentryConfig {
+	configs := make(map[string]sentryConfig)
+	for _, addresses := range d.resolved {
+		for _, address := range addresses {
+			configs[address] = d.defaults
+		}
+	}
+	return configs
+}
+
+// update records the result of resolving a name.
+func (d *dnsDiscovery) update(name string, addresses []string, err error) {
+	var dnsErr *net.DNSError
+	switch {
+	case err == nil:
+		d.resolved[name] = addresses
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		if _, ok := d.resolved[name]; ok {
+			d.log.Info("DNS name of sentries no longer exists", "name", name)
+		}
+		delete(d.resolved, name)
+	default:
+		// The sentries may still exist, keep them until the name can be resolved again.
+		d.log.Error("Failed to resolve DNS name of sentries", "name", name, "error", err)
+	}
+}
+
+// lookup returns the sentry addresses of the A/AAAA records of host on port.
+func (d *dnsDiscovery) lookup(ctx context.Context, host, port string) ([]string, error) {
+	ips, err := d.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]string, len(ips))
+	for i, ip := range ips {
+		addresses[i] = "tcp://" + net.JoinHostPort(ip.IP.String(), port)
+	}
+	return addresses, nil
+}
+
+// lookupSRV returns the sentry addresses of the targets of the SRV records of
+// name. Targets that do not exist are skipped.
+func (d *dnsDiscovery) lookupSRV(ctx context.Context, name string) ([]string, error) {
+	_, srvs, err := d.resolver.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		return nil, err
+	}
+
+	var addresses []string
+	for _, srv := range srvs {
+		found, err := d.lookup(ctx, srv.Target, strconv.Itoa(int(srv.Port)))
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			d.log.Debug("Skipping SRV target that does not exist", "name", name, "target", srv.Target)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve SRV target %s: %w", srv.Target, err)
+		}
+		addresses = append(addresses, found...)
+	}
+	return addresses, nil
+}
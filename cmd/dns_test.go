@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsStub is an in-process DNS server that answers A, AAAA and SRV queries
+// from its records. Names must be fully qualified.
+type dnsStub struct {
+	conn net.PacketConn
+
+	mu      sync.Mutex
+	ips     map[string][]net.IP
+	srvs    map[string][]net.SRV
+	failing map[string]bool
+}
+
+func newDNSStub(t *testing.T) *dnsStub {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	s := &dnsStub{
+		conn:    conn,
+		ips:     make(map[string][]net.IP),
+		srvs:    make(map[string][]net.SRV),
+		failing: make(map[string]bool),
+	}
+	go s.serve()
+	return s
+}
+
+func (s *dnsStub) addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+func (s *dnsStub) setIPs(name string, ips ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ips[name] = nil
+	for _, ip := range ips {
+		s.ips[name] = append(s.ips[name], net.ParseIP(ip))
+	}
+}
+
+func (s *dnsStub) setSRV(name string, srvs ...net.SRV) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.srvs[name] = srvs
+}
+
+func (s *dnsStub) remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ips, name)
+	delete(s.srvs, name)
+}
+
+// setFailing makes queries of name fail with SERVFAIL.
+func (s *dnsStub) setFailing(name string, failing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing[name] = failing
+}
+
+func (s *dnsStub) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp, err := s.answer(buf[:n]); err == nil {
+			_, _ = s.conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+func (s *dnsStub) answer(req []byte) ([]byte, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(req)
+	if err != nil {
+		return nil, err
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := strings.ToLower(q.Name.String())
+	ips, hasIPs := s.ips[name]
+	srvs, hasSRVs := s.srvs[name]
+
+	rcode := dnsmessage.RCodeSuccess
+	switch {
+	case s.failing[name]:
+		rcode = dnsmessage.RCodeServerFailure
+	case !hasIPs && !hasSRVs:
+		rcode = dnsmessage.RCodeNameError
+	}
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: h.ID, Response: true, Authoritative: true, RCode: rcode})
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	if rcode != dnsmessage.RCodeSuccess {
+		return b.Finish()
+	}
+
+	hdr := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 1}
+	switch q.Type {
+	case dnsmessage.TypeA:
+		for _, ip := range ips {
+			if ip4 := ip.To4(); ip4 != nil {
+				if err := b.AResource(hdr, dnsmessage.AResource{A: [4]byte(ip4)}); err != nil {
+					return nil, err
+				}
+			}
+		}
+	case dnsmessage.TypeAAAA:
+		for _, ip := range ips {
+			if ip.To4() == nil {
+				if err := b.AAAAResource(hdr, dnsmessage.AAAAResource{AAAA: [16]byte(ip.To16())}); err != nil {
+					return nil, err
+				}
+			}
+		}
+	case dnsmessage.TypeSRV:
+		for _, srv := range srvs {
+			target, err := dnsmessage.NewName(srv.Target)
+			if err != nil {
+				return nil, err
+			}
+			if err := b.SRVResource(hdr, dnsmessage.SRVResource{
+				Priority: srv.Priority,
+				Weight:   srv.Weight,
+				Port:     srv.Port,
+				Target:   target,
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b.Finish()
+}
+
+func TestDNSDiscovery(t *testing.T) {
+	ctx := context.Background()
+
+	stub := newDNSStub(t)
+	stub.setIPs("sentries.example.com.", "10.0.0.1", "10.0.0.2", "fd00::1")
+	stub.setSRV("_privval._tcp.example.com.",
+		net.SRV{Target: "a.example.com.", Port: 1234},
+		net.SRV{Target: "b.example.com.", Port: 2345},
+		net.SRV{Target: "gone.example.com.", Port: 3456},
+	)
+	stub.setIPs("a.example.com.", "10.0.1.1")
+	stub.setIPs("b.example.com.", "10.0.1.2")
+
+	signers := newFakeSigners()
+	r := newTestReconciler(t, signers)
+
+	d, err := newDNSDiscovery(DNSOptions{
+		Names:  []string{"sentries.example.com.:1234"},
+		SRV:    []string{"_privval._tcp.example.com."},
+		Server: stub.addr(),
+	}, defaultSentryConfig(1024), cometlog.NewNopLogger())
+	require.NoError(t, err)
+	refresh := func() {
+		d.refresh(ctx)
+		require.Empty(t, r.update(sourceDNS, desiredSentries(d.configs(), d.log)))
+	}
+
+	// targets of SRV records that don't exist are skipped
+	refresh()
+	require.Equal(t, []string{
+		"tcp://10.0.0.1:1234",
+		"tcp://10.0.0.2:1234",
+		"tcp://10.0.1.1:1234",
+		"tcp://10.0.1.2:2345",
+		"tcp://[fd00::1]:1234",
+	}, signers.addresses())
+
+	// only the signers of removed records are stopped
+	stub.setIPs("sentries.example.com.", "10.0.0.1", "fd00::1")
+	refresh()
+	require.Equal(t, []string{
+		"tcp://10.0.0.1:1234",
+		"tcp://10.0.1.1:1234",
+		"tcp://10.0.1.2:2345",
+		"tcp://[fd00::1]:1234",
+	}, signers.addresses())
+	require.Equal(t, 1, signers.startCount("tcp://10.0.0.1:1234"))
+
+	// sentries are kept while their name fails to resolve
+	stub.setFailing("sentries.example.com.", true)
+	refresh()
+	require.Len(t, signers.addresses(), 4)
+
+	// sentries are removed once their name no longer exists
+	stub.setFailing("sentries.example.com.", false)
+	stub.remove("sentries.example.com.")
+	refresh()
+	require.Equal(t, []string{"tcp://10.0.1.1:1234", "tcp://10.0.1.2:2345"}, signers.addresses())
+	require.Equal(t, 1, signers.startCount("tcp://10.0.1.1:1234"))
+}
+
+func TestSentryWatcherDNS(t *testing.T) {
+	ctx := context.Background()
+
+	stub := newDNSStub(t)
+	stub.setIPs("sentries.example.com.", "10.0.0.1")
+
+	signers := newFakeSigners()
+	w, err := NewSentryWatcher(ctx, nil, cometlog.NewNopLogger(), false, nil, false, KubeOptions{}, nil, 1024,
+		SentryWatcherSignerFactory(signers.factory),
+		SentryWatcherDNS(DNSOptions{
+			Names:    []string{"sentries.example.com.:1234"},
+			Interval: 10 * time.Millisecond,
+			Server:   stub.addr(),
+		}),
+	)
+	require.NoError(t, err)
+
+	go w.Watch(ctx, 1024)
+	require.Eventually(t, func() bool {
+		return len(signers.addresses()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stub.setIPs("sentries.example.com.", "10.0.0.1", "10.0.0.2")
+	require.Eventually(t, func() bool {
+		return len(signers.addresses()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, w.Stop())
+	require.Empty(t, signers.addresses())
+}
+
+func TestDNSOptionsValidate(t *testing.T) {
+	require.NoError(t, DNSOptions{Names: []string{"sentries.example.com:1234"}, SRV: []string{"_privval._tcp.example.com"}}.validate())
+	require.ErrorContains(t, DNSOptions{Names: []string{"sentries.example.com"}}.validate(), "must be HOST:PORT")
+	require.ErrorContains(t, DNSOptions{Names: []string{"sentries.example.com:privval"}}.validate(), "must be HOST:PORT")
+	require.ErrorContains(t, DNSOptions{Names: []string{":1234"}}.validate(), "must be HOST:PORT")
+	require.ErrorContains(t, DNSOptions{SRV: []string{""}}.validate(), "empty DNS SRV name")
+	require.ErrorContains(t, DNSOptions{Interval: -time.Second}.validate(), "invalid DNS interval")
+	require.ErrorContains(t, DNSOptions{Server: "127.0.0.1"}.validate(), "invalid DNS server")
+}
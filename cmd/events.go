@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/strangelove-ventures/horcrux-proxy/signer"
+)
+
+// Reasons of the Events recorded against sentry pods.
+const (
+	eventReasonDiscovered      = "SentryDiscovered"
+	eventReasonRemoved         = "SentryRemoved"
+	eventReasonConnected       = "SignerConnected"
+	eventReasonDisconnected    = "SignerDisconnected"
+	eventReasonHandshakeFailed = "SignerHandshakeFailed"
+	eventReasonRequestsFailing = "SignerRequestsFailing"
+)
+
+const (
+	// eventBurst and eventQPS rate-limit the Events of each sentry pod, so a
+	// flapping connection doesn't spam the API server. Events beyond the limit
+	// are dropped, and similar Events are aggregated into one with a count.
+	eventBurst = 10
+	eventQPS   = 1. / 60
+)
+
+// sentryEvents records Kubernetes Events about the connections to sentries
+// against the sentry pods, so they show up in kubectl describe.
+type sentryEvents struct {
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+}
+
+// newSentryEvents returns a sentryEvents that records Events through the client.
+func newSentryEvents(client kubernetes.Interface, host string) *sentryEvents {
+	broadcaster := record.NewBroadcasterWithCorrelatorOptions(record.CorrelatorOptions{
+		BurstSize: eventBurst,
+		QPS:       eventQPS,
+	})
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+
+	return &sentryEvents{
+		broadcaster: broadcaster,
+		recorder:    broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "horcrux-proxy", Host: host}),
+	}
+}
+
+// shutdown stops recording Events.
+func (ev *sentryEvents) shutdown() {
+	if ev == nil || ev.broadcaster == nil {
+		return
+	}
+	ev.broadcaster.Shutdown()
+}
+
+// record records an Event against the pod of the sentry endpoint. It is a no-op
+// if ev is nil.
+func (ev *sentryEvents) record(e sentryEndpoint, eventtype, reason, messageFmt string, args ...any) {
+	if ev == nil {
+		return
+	}
+	ref := &corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Namespace:  e.namespace,
+		Name:       e.pod,
+		UID:        e.podUID,
+	}
+	ev.recorder.Eventf(ref, eventtype, reason, messageFmt, args...)
+}
+
+// handler returns the remote signer event handler of the sentry endpoint.
+func (ev *sentryEvents) handler(e sentryEndpoint) signer.RemoteSignerEventHandler {
+	return func(event signer.RemoteSignerEvent, err error) {
+		switch event {
+		case signer.RemoteSignerConnected:
+			ev.record(e, corev1.EventTypeNormal, eventReasonConnected, "Connected to sentry at %s", e.address)
+		case signer.RemoteSignerDisconnected:
+			ev.record(e, corev1.EventTypeWarning, eventReasonDisconnected, "Lost connection to sentry at %s: %v", e.address, err)
+		case signer.RemoteSignerHandshakeFailed:
+			ev.record(e, corev1.EventTypeWarning, eventReasonHandshakeFailed, "Handshake with sentry at %s failed: %v", e.address, err)
+		case signer.RemoteSignerRequestsFailing:
+			ev.record(e, corev1.EventTypeWarning, eventReasonRequestsFailing, "Repeated signing requests from sentry at %s failed: %v", e.address, err)
+		}
+	}
+}
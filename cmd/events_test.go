@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/strangelove-ventures/horcrux-proxy/signer"
+)
+
+// requireEvent waits for the event, skipping events of the remote signer
+// dialing the unreachable test sentries.
+func requireEvent(t *testing.T, recorder *record.FakeRecorder, want string) {
+	t.Helper()
+	for {
+		select {
+		case event := <-recorder.Events:
+			if event == want {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected event %q", want)
+		}
+	}
+}
+
+func TestSentryWatcherEvents(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		sentryService("sentry", "default"), sentryPod("sentry-0", "default", "sentry", "node-a", "10.0.0.1"),
+	)
+	recorder := record.NewFakeRecorder(100)
+
+	w := newTestWatcher()
+	c := &kubeCluster{
+		all:      true,
+		events:   &sentryEvents{recorder: recorder},
+		selector: testSelector(),
+		log:      cometlog.NewNopLogger(),
+	}
+	w.addCluster(c)
+	require.NoError(t, c.setClient(client, []string{"default"}))
+	c.startInformers(w.stop)
+	t.Cleanup(func() {
+		close(w.stop)
+		_ = w.reconciler.stop()
+	})
+
+	ctx := context.Background()
+
+	require.NoError(t, w.reconcileSentries(ctx, 1024))
+	requireEvent(t, recorder, "Normal SentryDiscovered Discovered sentry at tcp://10.0.0.1:1234, connecting")
+
+	handler := c.events.handler(*w.reconciler.sentries["tcp://10.0.0.1:1234"].endpoint)
+	handler(signer.RemoteSignerHandshakeFailed, errors.New("EOF"))
+	requireEvent(t, recorder, "Warning SignerHandshakeFailed Handshake with sentry at tcp://10.0.0.1:1234 failed: EOF")
+
+	require.NoError(t, client.CoreV1().Pods("default").Delete(ctx, "sentry-0", metav1.DeleteOptions{}))
+	require.Eventually(t, func() bool {
+		require.NoError(t, w.reconcileSentries(ctx, 1024))
+		return len(w.reconciler.sentries) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	requireEvent(t, recorder, "Normal SentryRemoved Sentry at tcp://10.0.0.1:1234 is no longer discovered, disconnecting")
+}
@@ -0,0 +1,274 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultSentryFileInterval is how often sentry files are checked for changes.
+const DefaultSentryFileInterval = 5 * time.Second
+
+// FileOptions configure sentry discovery through sentry files, in the style
+// of Prometheus file_sd, e.g. for sentry lists generated by Terraform.
+type FileOptions struct {
+	// Paths of the sentry files. The last element of a path may be a glob
+	// pattern, e.g. /etc/horcrux-proxy/sentries/*.yaml.
+	Paths []string
+
+	// Interval is how often the files are checked for changes. Defaults to
+	// DefaultSentryFileInterval.
+	Interval time.Duration
+}
+
+// enabled reports whether any paths are configured.
+func (o FileOptions) enabled() bool {
+	return len(o.Paths) > 0
+}
+
+// validate returns an error if any of the options is invalid.
+func (o FileOptions) validate() error {
+	var errs []error
+	for _, path := range o.Paths {
+		if _, err := filepath.Match(path, ""); err != nil || path == "" {
+			errs = append(errs, fmt.Errorf("invalid sentry file path %q", path))
+		}
+	}
+	if o.Interval < 0 {
+		errs = append(errs, fmt.Errorf("invalid sentry file interval %s", o.Interval))
+	}
+	return errors.Join(errs...)
+}
+
+// SentryGroup is a group of sentries in a sentry file or a sentry URL
+// response, like a Prometheus file_sd target group. The settings apply to each
+// of the targets, and zero settings default to those of discovered sentries. A
+// sentry file is a YAML or JSON list of groups, and a sentry URL returns a JSON
+// list of groups, e.g.
+//
+//	[{"targets": ["tcp://10.0.0.1:1234", "tcp://10.0.0.2:1234"], "chainIDs": ["cosmoshub-4"]}]
+type SentryGroup struct {
+	Targets     []string `json:"targets"`
+	ChainIDs    []string `json:"chainIDs,omitempty"`
+	MaxReadSize int      `json:"maxReadSize,omitempty"`
+	DialTimeout Duration `json:"dialTimeout,omitempty"`
+	NodeID      string   `json:"nodeID,omitempty"`
+}
+
+// loadSentryFile parses the content of the sentry file at path into the
+// configs of its sentries, keyed by address.
+func loadSentryFile(path string, bz []byte, defaults sentryConfig) (map[string]sentryConfig, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml", ".json":
+	default:
+		return nil, fmt.Errorf("unsupported sentry file extension %q, must be .yaml, .yml or .json", ext)
+	}
+
+	jsonBz, err := yaml.YAMLToJSON(bz)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sentry file: %w", err)
+	}
+	return parseSentryGroups(jsonBz, defaults)
+}
+
+// parseSentryGroups parses a JSON list of SentryGroups into the configs of
+// their sentries, keyed by address.
+func parseSentryGroups(jsonBz []byte, defaults sentryConfig) (map[string]sentryConfig, error) {
+	var groups []SentryGroup
+	if err := decodeStrict(jsonBz, &groups); err != nil {
+		return nil, fmt.Errorf("failed to decode sentry groups: %w", err)
+	}
+
+	configs := make(map[string]sentryConfig)
+	for i, g := range groups {
+		s := StaticSentry{ChainIDs: g.ChainIDs, MaxReadSize: g.MaxReadSize, DialTimeout: g.DialTimeout, NodeID: g.NodeID}
+		config, err := s.config(defaults)
+		if err != nil {
+			return nil, fmt.Errorf("group %d: %w", i, err)
+		}
+		for _, target := range g.Targets {
+			if target == "" {
+				return nil, fmt.Errorf("group %d: empty target", i)
+			}
+			if _, exists := configs[target]; exists {
+				return nil, fmt.Errorf("group %d: duplicate target %s", i, target)
+			}
+			configs[target] = config
+		}
+	}
+	return configs, nil
+}
+
+// sentryFile is a loaded sentry file.
+type sentryFile struct {
+	hash    [sha256.Size]byte
+	configs map[string]sentryConfig
+}
+
+// fileDiscovery is the Discoverer of the sentries of sentry files, which it
+// reads at an interval. Files are only parsed when their content changes. If a
+// file becomes invalid, its previously loaded sentries are kept until it is
+// fixed. The sentries of files that are removed are removed.
+type fileDiscovery struct {
+	opts     FileOptions
+	defaults sentryConfig
+	log      cometlog.Logger
+
+	files map[string]*sentryFile
+
+	// configs are the sentries of all the files, keyed by address.
+	configs map[string]sentryConfig
+}
+
+var _ Discoverer = (*fileDiscovery)(nil)
+
+// newFileDiscovery returns a fileDiscovery of the options, that configures the
+// sentries by defaults.
+func newFileDiscovery(
+	opts FileOptions,
+	defaults sentryConfig,
+	logger cometlog.Logger,
+) (*fileDiscovery, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if opts.Interval == 0 {
+		opts.Interval = DefaultSentryFileInterval
+	}
+	return &fileDiscovery{
+		opts:     opts,
+		defaults: defaults,
+		log:      logger,
+		files:    make(map[string]*sentryFile),
+	}, nil
+}
+
+// Name implements Discoverer.
+func (d *fileDiscovery) Name() string {
+	return sourceFile
+}
+
+// Run implements Discoverer. It reads the files right away, and then at the
+// interval until stop is closed. The sentries are updated after every read,
+// so those that failed to start are retried.
+func (d *fileDiscovery) Run(ctx context.Context, stop <-chan struct{}, update SentryUpdate) {
+	ticker := time.NewTicker(d.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		d.refresh()
+		if err := (ReconcileResult{Errors: update(desiredSentries(d.configs, d.log))}).Err(); err != nil {
+			d.log.Error("Failed to update file sentries", "error", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// paths returns the paths of the files that match the configured paths.
+func (d *fileDiscovery) paths() []string {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, pattern := range d.opts.Paths {
+		// The pattern is validated, so the only error is ErrBadPattern.
+		matches, _ := filepath.Glob(pattern)
+		for _, path := range matches {
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// refresh reloads the files that changed and merges their sentries.
+func (d *fileDiscovery) refresh() {
+	paths := d.paths()
+	changed := false
+
+	current := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		current[path] = true
+		if d.load(path) {
+			changed = true
+		}
+	}
+	for path := range d.files {
+		if !current[path] {
+			d.log.Info("Sentry file removed", "path", path)
+			delete(d.files, path)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return
+	}
+
+	configs := make(map[string]sentryConfig)
+	for _, path := range paths {
+		f, ok := d.files[path]
+		if !ok {
+			continue
+		}
+		for address, config := range f.configs {
+			if _, exists := configs[address]; exists {
+				d.log.Error("Sentry is in several sentry files, using the first", "address", address, "path", path)
+				continue
+			}
+			configs[address] = config
+		}
+	}
+	d.configs = configs
+}
+
+// load reloads the file at path if its content changed, and reports whether
+// its sentries changed.
+func (d *fileDiscovery) load(path string) bool {
+	bz, err := os.ReadFile(path)
+	if err != nil {
+		// Removed between the glob and the read, it is dropped on the next refresh.
+		if !errors.Is(err, os.ErrNotExist) {
+			d.log.Error("Failed to read sentry file", "path", path, "error", err)
+		}
+		return false
+	}
+
+	hash := sha256.Sum256(bz)
+	f, ok := d.files[path]
+	if ok && f.hash == hash {
+		return false
+	}
+
+	configs, err := loadSentryFile(path, bz, d.defaults)
+	if err != nil {
+		d.log.Error("Failed to load sentry file, keeping its current sentries", "path", path, "error", err)
+		if ok {
+			// Remember the content so the error is only logged once per change.
+			f.hash = hash
+		} else {
+			d.files[path] = &sentryFile{hash: hash}
+		}
+		return false
+	}
+
+	d.log.Info("Loaded sentry file", "path", path, "sentries", len(configs))
+	d.files[path] = &sentryFile{hash: hash, configs: configs}
+	return true
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSentryFile(t *testing.T) {
+	defaults := defaultSentryConfig(1024)
+
+	configs, err := loadSentryFile("sentries.yaml", []byte(`
+- targets: [tcp://a:1234, tcp://b:1234]
+  chainIDs: [cosmoshub-4]
+- targets: [tcp://c:1234]
+  dialTimeout: 5s
+`), defaults)
+	require.NoError(t, err)
+	require.Len(t, configs, 3)
+	require.Equal(t, []string{"cosmoshub-4"}, configs["tcp://a:1234"].chainIDs)
+	require.Equal(t, []string{"cosmoshub-4"}, configs["tcp://b:1234"].chainIDs)
+	require.Equal(t, 5*time.Second, configs["tcp://c:1234"].dialTimeout)
+	require.False(t, defaults.equal(configs["tcp://c:1234"]))
+
+	configs, err = loadSentryFile("sentries.json", []byte(`[{"targets": ["tcp://a:1234"]}]`), defaults)
+	require.NoError(t, err)
+	require.True(t, defaults.equal(configs["tcp://a:1234"]))
+
+	_, err = loadSentryFile("sentries.json", []byte(`[{"target": ["tcp://a:1234"]}]`), defaults)
+	require.ErrorContains(t, err, "unknown field")
+
+	_, err = loadSentryFile("sentries.yaml", []byte("- targets: [tcp://a:1234]\n- targets: [tcp://a:1234]\n"), defaults)
+	require.ErrorContains(t, err, "duplicate target")
+
+	_, err = loadSentryFile("sentries.yaml", []byte("- targets: [tcp://a:1234]\n  nodeID: abc\n"), defaults)
+	require.ErrorContains(t, err, "invalid nodeID")
+
+	_, err = loadSentryFile("sentries.toml", nil, defaults)
+	require.ErrorContains(t, err, "unsupported sentry file extension")
+}
+
+func TestFileDiscovery(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+	write("a.yaml", "- targets: [tcp://a:1234, tcp://b:1234]\n")
+	write("b.json", `[{"targets": ["tcp://c:1234"]}]`)
+
+	signers := newFakeSigners()
+	r := newTestReconciler(t, signers)
+
+	d, err := newFileDiscovery(FileOptions{
+		Paths: []string{filepath.Join(dir, "*.yaml"), filepath.Join(dir, "b.json")},
+	}, defaultSentryConfig(1024), cometlog.NewNopLogger())
+	require.NoError(t, err)
+	refresh := func() {
+		d.refresh()
+		require.Empty(t, r.update(sourceFile, desiredSentries(d.configs, d.log)))
+	}
+
+	refresh()
+	require.Equal(t, []string{"tcp://a:1234", "tcp://b:1234", "tcp://c:1234"}, signers.addresses())
+
+	// only the signers of changed sentries are started or stopped
+	write("a.yaml", "- targets: [tcp://a:1234]\n- targets: [tcp://b:1234]\n  dialTimeout: 5s\n")
+	refresh()
+	require.Equal(t, []string{"tcp://a:1234", "tcp://b:1234", "tcp://c:1234"}, signers.addresses())
+	require.Equal(t, 1, signers.startCount("tcp://a:1234"))
+	require.Equal(t, 2, signers.startCount("tcp://b:1234"))
+	require.Equal(t, 1, signers.startCount("tcp://c:1234"))
+
+	// new files matching a glob are picked up
+	write("c.yaml", "- targets: [tcp://d:1234]\n")
+	refresh()
+	require.Equal(t, []string{"tcp://a:1234", "tcp://b:1234", "tcp://c:1234", "tcp://d:1234"}, signers.addresses())
+
+	// the sentries of an invalid file are kept until it is fixed
+	write("a.yaml", "- targets: [tcp://a:1234\n")
+	refresh()
+	require.Equal(t, []string{"tcp://a:1234", "tcp://b:1234", "tcp://c:1234", "tcp://d:1234"}, signers.addresses())
+
+	// the sentries of removed files are removed
+	require.NoError(t, os.Remove(filepath.Join(dir, "a.yaml")))
+	require.NoError(t, os.Remove(filepath.Join(dir, "b.json")))
+	refresh()
+	require.Equal(t, []string{"tcp://d:1234"}, signers.addresses())
+	require.Equal(t, 1, signers.startCount("tcp://d:1234"))
+}
+
+func TestSentryWatcherFiles(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "sentries.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("- targets: [tcp://a:1234]\n"), 0600))
+
+	signers := newFakeSigners()
+	w, err := NewSentryWatcher(ctx, nil, cometlog.NewNopLogger(), false, nil, false, KubeOptions{}, nil, 1024,
+		SentryWatcherSignerFactory(signers.factory),
+		SentryWatcherFiles(FileOptions{Paths: []string{path}, Interval: 10 * time.Millisecond}),
+	)
+	require.NoError(t, err)
+
+	go w.Watch(ctx, 1024)
+	require.Eventually(t, func() bool {
+		return len(signers.addresses()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(path, []byte("- targets: [tcp://a:1234, tcp://b:1234]\n"), 0600))
+	require.Eventually(t, func() bool {
+		return len(signers.addresses()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, w.Stop())
+	require.Empty(t, signers.addresses())
+}
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Sentry discovery modes.
+const (
+	// DiscoveryLabels discovers sentries from Services with the sentry labels
+	// and a sentry-privval port.
+	DiscoveryLabels = "labels"
+
+	// DiscoveryCRD discovers sentries from cosmos-operator CosmosFullNode
+	// resources of type Sentry.
+	DiscoveryCRD = "crd"
+)
+
+const (
+	fullNodeTypeSentry = "Sentry"
+
+	// fullNodePrivvalPortName is the name of the container port that
+	// cosmos-operator sentry pods listen for the privval connection on.
+	fullNodePrivvalPortName = "privval"
+
+	labelName     = "app.kubernetes.io/name"
+	labelInstance = "app.kubernetes.io/instance"
+)
+
+// fullNodeGVR is the resource of cosmos-operator CosmosFullNodes.
+var fullNodeGVR = schema.GroupVersionResource{
+	Group:    "cosmos.strange.love",
+	Version:  "v1",
+	Resource: "cosmosfullnodes",
+}
+
+// fullNodeSentry is the sentry relevant part of a CosmosFullNode of type Sentry.
+type fullNodeSentry struct {
+	name        string
+	namespace   string
+	labels      map[string]string
+	annotations map[string]string
+	chainID     string
+	replicas    int64
+}
+
+// parseFullNodeSentry returns the sentry of a CosmosFullNode, and false if the
+// CosmosFullNode is not of type Sentry.
+//
+// The status of the CosmosFullNode is not read. Its phase is Progressing
+// during every rollout, while most sentry pods keep serving, and it says
+// nothing about a single pod. Whether a pod can be connected to is decided
+// by the pod's own readiness instead, see kubeCluster.readyPods.
+func parseFullNodeSentry(obj *unstructured.Unstructured) (fullNodeSentry, bool, error) {
+	typ, _, err := unstructured.NestedString(obj.Object, "spec", "type")
+	if err != nil {
+		return fullNodeSentry{}, false, fmt.Errorf("invalid spec.type: %w", err)
+	}
+	if typ != fullNodeTypeSentry {
+		return fullNodeSentry{}, false, nil
+	}
+
+	chainID, _, err := unstructured.NestedString(obj.Object, "spec", "chain", "chainID")
+	if err != nil {
+		return fullNodeSentry{}, false, fmt.Errorf("invalid spec.chain.chainID: %w", err)
+	}
+
+	replicas, _, err := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if err != nil {
+		return fullNodeSentry{}, false, fmt.Errorf("invalid spec.replicas: %w", err)
+	}
+
+	return fullNodeSentry{
+		name:        obj.GetName(),
+		namespace:   obj.GetNamespace(),
+		labels:      obj.GetLabels(),
+		annotations: obj.GetAnnotations(),
+		chainID:     chainID,
+		replicas:    replicas,
+	}, true, nil
+}
+
+// key returns the namespace/name key of the CosmosFullNode.
+func (s fullNodeSentry) key() string {
+	return s.namespace + "/" + s.name
+}
+
+// podSelector selects the pods of the CosmosFullNode.
+func (s fullNodeSentry) podSelector() labels.Selector {
+	return labels.SelectorFromSet(labels.Set{labelName: s.name})
+}
+
+// hasPod reports whether the pod is one of the sentry replicas. Pods with an
+// ordinal beyond the replicas are being scaled down.
+func (s fullNodeSentry) hasPod(pod *corev1.Pod) bool {
+	for i := int64(0); i < s.replicas; i++ {
+		if pod.Labels[labelInstance] == s.name+"-"+strconv.FormatInt(i, 10) {
+			return true
+		}
+	}
+	return false
+}
+
+// sentriesFromFullNodes returns the privval endpoints of the sentry pods of the
+// CosmosFullNodes of one namespace that match the selector. Requests through
+// them are restricted to the chain ID of the CosmosFullNode unless its
+// annotations say otherwise.
+func (c *kubeCluster) sentriesFromFullNodes(
+	inf namespaceInformers,
+	defaults sentryConfig,
+) ([]sentryEndpoint, map[string]error) {
+	errs := make(map[string]error)
+
+	objs, err := inf.fullNodeLister.List(labels.Everything())
+	if err != nil {
+		errs[inf.namespace] = fmt.Errorf("failed to list cosmosfullnodes: %w", err)
+		return nil, errs
+	}
+
+	var endpoints []sentryEndpoint
+	for _, obj := range objs {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+
+		s, ok, err := parseFullNodeSentry(u)
+		if err != nil {
+			errs[u.GetNamespace()+"/"+u.GetName()] = err
+			continue
+		}
+		if !ok || ignoreService(s.annotations) || !c.selector.Matches(labels.Set(s.labels)) {
+			continue
+		}
+
+		chainDefaults := defaults
+		if s.chainID != "" {
+			chainDefaults.chainIDs = []string{s.chainID}
+		}
+		config, err := parseSentryConfig(s.annotations, chainDefaults)
+		if err != nil {
+			errs[s.key()] = err
+			continue
+		}
+
+		privvalPortName, err := portName(s.annotations, fullNodePrivvalPortName)
+		if err != nil {
+			errs[s.key()] = err
+			continue
+		}
+
+		all, err := inf.podLister.Pods(s.namespace).List(s.podSelector())
+		if err != nil {
+			errs[s.key()] = fmt.Errorf("failed to list pods: %w", err)
+			continue
+		}
+
+		var pods []*corev1.Pod
+		for _, pod := range all {
+			if s.hasPod(pod) {
+				pods = append(pods, pod)
+			}
+		}
+
+		pods = c.readyPods(pods)
+
+		if !c.all {
+			var domain string
+			pods, domain = c.topology.selectPods(pods)
+			if len(pods) > 0 && domain != corev1.LabelHostname {
+				c.log.Debug("No healthy sentry on this node, using wider topology domain",
+					"namespace", s.namespace, "cosmosfullnode", s.name, "topology", domain)
+			}
+		}
+
+		for _, pod := range pods {
+			if pod.Status.PodIP == "" {
+				continue
+			}
+
+			port, ok := podPrivvalPort(corev1.ServicePort{TargetPort: intstr.FromString(privvalPortName)}, pod)
+			if !ok {
+				errs[s.key()] = fmt.Errorf("pod %s has no %s container port", pod.Name, privvalPortName)
+				continue
+			}
+
+			endpoints = append(endpoints, sentryEndpoint{
+				cluster:   c,
+				address:   "tcp://" + net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(port))),
+				namespace: s.namespace,
+				service:   s.name,
+				pod:       pod.Name,
+				podUID:    pod.UID,
+				node:      pod.Spec.NodeName,
+				config:    config,
+			})
+		}
+	}
+
+	return endpoints, errs
+}
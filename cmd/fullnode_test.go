@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func cosmosFullNode(name, namespace, typ, chainID string, replicas int64) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "cosmos.strange.love/v1",
+		"kind":       "CosmosFullNode",
+		"metadata": map[string]any{
+			"name":      name,
+			"namespace": namespace,
+		},
+		"spec": map[string]any{
+			"type":     typ,
+			"replicas": replicas,
+			"chain":    map[string]any{"chainID": chainID},
+		},
+	}}
+}
+
+func fullNodePod(name, namespace, fullNode, node, ip string, privvalPort int32) *corev1.Pod {
+	pod := sentryPod(name, namespace, name, node, ip)
+	pod.Labels[labelName] = fullNode
+	if privvalPort != 0 {
+		pod.Spec.Containers = []corev1.Container{{
+			Name:  "node",
+			Ports: []corev1.ContainerPort{{Name: fullNodePrivvalPortName, ContainerPort: privvalPort}},
+		}}
+	}
+	return pod
+}
+
+func TestSentryWatcherFullNodes(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		fullNodePod("cosmoshub-0", "default", "cosmoshub", "node-a", "10.0.0.1", 1234),
+		fullNodePod("cosmoshub-1", "default", "cosmoshub", "node-b", "10.0.0.2", 1234),
+		// scaled down, not part of the replicas anymore
+		fullNodePod("cosmoshub-2", "default", "cosmoshub", "node-c", "10.0.0.3", 1234),
+		fullNodePod("osmosis-0", "default", "osmosis", "node-a", "10.0.0.4", 26659),
+		fullNodePod("osmosis-validator-0", "default", "osmosis-validator", "node-a", "10.0.0.5", 1234),
+		// no privval port to connect to
+		fullNodePod("juno-0", "default", "juno", "node-a", "10.0.0.6", 0),
+		fullNodePod("testnet-0", "default", "testnet", "node-a", "10.0.0.7", 1234),
+	)
+
+	juno := cosmosFullNode("juno", "default", fullNodeTypeSentry, "juno-1", 1)
+	juno.SetAnnotations(map[string]string{annotationPortName: "signer"})
+	testnet := cosmosFullNode("testnet", "default", fullNodeTypeSentry, "theta-testnet-001", 1)
+	testnet.SetLabels(map[string]string{"network": "testnet"})
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{fullNodeGVR: "CosmosFullNodeList"},
+		cosmosFullNode("cosmoshub", "default", fullNodeTypeSentry, "cosmoshub-4", 2),
+		cosmosFullNode("osmosis", "default", fullNodeTypeSentry, "osmosis-1", 1),
+		cosmosFullNode("osmosis-validator", "default", "FullNode", "osmosis-1", 1),
+		juno,
+		testnet,
+	)
+
+	selector, err := newSentrySelector(nil, SelectorOptions{Excludes: []string{"network=testnet"}, NoDefault: true})
+	require.NoError(t, err)
+
+	w := newTestWatcher()
+	c := &kubeCluster{
+		all:       true,
+		discovery: DiscoveryCRD,
+		selector:  selector,
+		log:       cometlog.NewNopLogger(),
+	}
+	w.addCluster(c)
+	require.NoError(t, c.setClient(client, []string{"default"}))
+	require.NoError(t, c.setFullNodeClient(dynamicClient))
+	require.Nil(t, c.informers[0].serviceLister)
+
+	c.startInformers(w.stop)
+	t.Cleanup(func() {
+		close(w.stop)
+		_ = w.reconciler.stop()
+	})
+
+	err = w.reconcileSentries(context.Background(), 1024)
+	require.ErrorContains(t, err, "pod juno-0 has no signer container port")
+
+	addresses := make([]string, 0, len(w.reconciler.sentries))
+	for address := range w.reconciler.sentries {
+		addresses = append(addresses, address)
+	}
+	require.ElementsMatch(t, []string{
+		"tcp://10.0.0.1:1234",
+		"tcp://10.0.0.2:1234",
+		"tcp://10.0.0.4:26659",
+	}, addresses)
+
+	require.Equal(t, []string{"cosmoshub-4"}, w.reconciler.sentries["tcp://10.0.0.1:1234"].endpoint.config.chainIDs)
+	require.Equal(t, []string{"osmosis-1"}, w.reconciler.sentries["tcp://10.0.0.4:26659"].endpoint.config.chainIDs)
+	require.Equal(t, "default/cosmoshub", w.reconciler.sentries["tcp://10.0.0.2:1234"].endpoint.serviceKey())
+}
+
+func TestSentryWatcherFullNodesClients(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset(
+		fullNodePod("cosmoshub-0", "default", "cosmoshub", "node-a", "10.0.0.1", 1234),
+	)
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{fullNodeGVR: "CosmosFullNodeList"},
+		cosmosFullNode("cosmoshub", "default", fullNodeTypeSentry, "cosmoshub-4", 1),
+	)
+	signers := newFakeSigners()
+
+	kubeOpts := KubeOptions{
+		Client:        client,
+		DynamicClient: dynamicClient,
+		Namespaces:    []string{"default"},
+		Discovery:     DiscoveryCRD,
+	}
+	w, err := NewSentryWatcher(ctx, nil, cometlog.NewNopLogger(), true, nil, true, kubeOpts, nil, 1024,
+		SentryWatcherSignerFactory(signers.factory))
+	require.NoError(t, err)
+
+	go w.Watch(ctx, 1024)
+	t.Cleanup(func() { require.NoError(t, w.Stop()) })
+
+	require.Eventually(t, func() bool {
+		return equalStrings([]string{"tcp://10.0.0.1:1234"}, signers.addresses())
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestParseFullNodeSentry(t *testing.T) {
+	s, ok, err := parseFullNodeSentry(cosmosFullNode("cosmoshub", "default", fullNodeTypeSentry, "cosmoshub-4", 3))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, fullNodeSentry{name: "cosmoshub", namespace: "default", chainID: "cosmoshub-4", replicas: 3}, s)
+
+	_, ok, err = parseFullNodeSentry(cosmosFullNode("cosmoshub", "default", "FullNode", "cosmoshub-4", 3))
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	invalid := cosmosFullNode("cosmoshub", "default", fullNodeTypeSentry, "cosmoshub-4", 3)
+	invalid.Object["spec"].(map[string]any)["replicas"] = "three"
+	_, _, err = parseFullNodeSentry(invalid)
+	require.Error(t, err)
+}
@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+)
+
+const (
+	// DefaultHTTPInterval is how often the sentry URL is polled.
+	DefaultHTTPInterval = 30 * time.Second
+
+	// maxHTTPResponseSize is the max size of a sentry URL response body.
+	maxHTTPResponseSize = 10 << 20
+)
+
+// HTTPOptions configure sentry discovery through an HTTP endpoint, e.g. of an
+// inventory service, that returns a JSON list of SentryGroups.
+type HTTPOptions struct {
+	// URL of the endpoint.
+	URL string
+
+	// Interval is how often the URL is polled. Defaults to DefaultHTTPInterval.
+	Interval time.Duration
+
+	// AuthHeader is the name of the header to send the content of AuthFile in.
+	// Defaults to Authorization.
+	AuthHeader string
+
+	// AuthFile is the path of a file with the value of AuthHeader, e.g.
+	// "Bearer <token>". It is re-read on every request, so tokens can be
+	// rotated without a restart.
+	AuthFile string
+
+	// CAFile is the path of the PEM CA certificates to verify the server with,
+	// instead of the system roots.
+	CAFile string
+
+	// CertFile and KeyFile are the paths of the PEM client certificate and key
+	// for mutual TLS.
+	CertFile string
+	KeyFile  string
+
+	// InsecureSkipVerify disables the verification of the server certificate.
+	InsecureSkipVerify bool
+}
+
+// enabled reports whether a URL is configured.
+func (o HTTPOptions) enabled() bool {
+	return o.URL != ""
+}
+
+// validate returns an error if any of the options is invalid.
+func (o HTTPOptions) validate() error {
+	var errs []error
+	if o.URL != "" {
+		u, err := url.Parse(o.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid sentry URL %q, must be an http or https URL", o.URL))
+		}
+	}
+	if o.Interval < 0 {
+		errs = append(errs, fmt.Errorf("invalid sentry URL interval %s", o.Interval))
+	}
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		errs = append(errs, errors.New("sentry URL client certificate and key must be set together"))
+	}
+	return errors.Join(errs...)
+}
+
+// client returns the HTTP client of the TLS settings of the options.
+func (o HTTPOptions) client() (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sentry URL CA file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in sentry URL CA file %s", o.CAFile)
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	if o.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load sentry URL client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport, Timeout: o.Interval}, nil
+}
+
+// httpDiscovery is the Discoverer of the sentries returned by the sentry URL,
+// which it polls at an interval. The ETag of the last good response is sent in
+// If-None-Match, so an unchanged list isn't sent again. If the URL can't be
+// reached or returns an invalid list, the last good list is kept.
+type httpDiscovery struct {
+	opts     HTTPOptions
+	client   *http.Client
+	defaults sentryConfig
+	log      cometlog.Logger
+
+	// configs are the sentries of the last good response, and etag its ETag.
+	configs map[string]sentryConfig
+	etag    string
+}
+
+var _ Discoverer = (*httpDiscovery)(nil)
+
+// newHTTPDiscovery returns an httpDiscovery of the options, that configures the
+// sentries by defaults.
+func newHTTPDiscovery(
+	opts HTTPOptions,
+	defaults sentryConfig,
+	logger cometlog.Logger,
+) (*httpDiscovery, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if opts.Interval == 0 {
+		opts.Interval = DefaultHTTPInterval
+	}
+	if opts.AuthHeader == "" {
+		opts.AuthHeader = "Authorization"
+	}
+	client, err := opts.client()
+	if err != nil {
+		return nil, err
+	}
+	return &httpDiscovery{
+		opts:     opts,
+		client:   client,
+		defaults: defaults,
+		log:      logger,
+	}, nil
+}
+
+// Name implements Discoverer.
+func (d *httpDiscovery) Name() string {
+	return sourceHTTP
+}
+
+// Run implements Discoverer. It polls the URL right away, and then at the
+// interval until stop is closed. The sentries are updated after every poll,
+// so those that failed to start are retried.
+func (d *httpDiscovery) Run(ctx context.Context, stop <-chan struct{}, update SentryUpdate) {
+	ticker := time.NewTicker(d.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.refresh(ctx); err != nil {
+			d.log.Error("Failed to poll sentry URL", "url", d.opts.URL, "error", err)
+		}
+		if err := (ReconcileResult{Errors: update(desiredSentries(d.configs, d.log))}).Err(); err != nil {
+			d.log.Error("Failed to update sentry URL sentries", "error", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh polls the URL and replaces the sentries with those it returns,
+// unless they are unchanged.
+func (d *httpDiscovery) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.opts.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if d.etag != "" {
+		req.Header.Set("If-None-Match", d.etag)
+	}
+	if d.opts.AuthFile != "" {
+		auth, err := os.ReadFile(d.opts.AuthFile)
+		if err != nil {
+			return fmt.Errorf("failed to read auth file: %w", err)
+		}
+		req.Header.Set(d.opts.AuthHeader, strings.TrimSpace(string(auth)))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return nil
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPResponseSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if len(body) > maxHTTPResponseSize {
+		return fmt.Errorf("response is larger than %d bytes", maxHTTPResponseSize)
+	}
+
+	configs, err := parseSentryGroups(body, d.defaults)
+	if err != nil {
+		return err
+	}
+
+	d.configs = configs
+	d.etag = resp.Header.Get("ETag")
+	return nil
+}
@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/stretchr/testify/require"
+)
+
+// sentryServer is the handler of a fake inventory service that serves a
+// sentry list with an ETag.
+type sentryServer struct {
+	mu     sync.Mutex
+	body   string
+	etag   string
+	status int
+	auth   string
+	notMod int
+}
+
+func (s *sentryServer) set(body, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.body, s.etag = body, etag
+}
+
+func (s *sentryServer) setStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+func (s *sentryServer) notModified() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.notMod
+}
+
+func (s *sentryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.auth != "" && r.Header.Get("Authorization") != s.auth {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+	if s.etag != "" && r.Header.Get("If-None-Match") == s.etag {
+		s.notMod++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", s.etag)
+	_, _ = w.Write([]byte(s.body))
+}
+
+// newTestHTTPDiscovery returns an httpDiscovery of the options, and a refresh
+// func that polls the URL and passes the sentries to a test reconciler.
+func newTestHTTPDiscovery(t *testing.T, opts HTTPOptions) (func(context.Context) error, *fakeSigners) {
+	signers := newFakeSigners()
+	r := newTestReconciler(t, signers)
+
+	d, err := newHTTPDiscovery(opts, defaultSentryConfig(1024), cometlog.NewNopLogger())
+	require.NoError(t, err)
+	refresh := func(ctx context.Context) error {
+		err := d.refresh(ctx)
+		require.Empty(t, r.update(sourceHTTP, desiredSentries(d.configs, d.log)))
+		return err
+	}
+	return refresh, signers
+}
+
+func TestHTTPDiscovery(t *testing.T) {
+	ctx := context.Background()
+
+	handler := &sentryServer{auth: "Bearer secret"}
+	handler.set(`[{"targets": ["tcp://a:1234", "tcp://b:1234"], "chainIDs": ["cosmoshub-4"]}]`, `"v1"`)
+	srv := httptest.NewServer(handler)
+
+	authFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(authFile, []byte("Bearer secret\n"), 0600))
+
+	refresh, signers := newTestHTTPDiscovery(t, HTTPOptions{URL: srv.URL, AuthFile: authFile})
+
+	require.NoError(t, refresh(ctx))
+	require.Equal(t, []string{"tcp://a:1234", "tcp://b:1234"}, signers.addresses())
+
+	// an unchanged list is not sent again
+	require.NoError(t, refresh(ctx))
+	require.Equal(t, 1, handler.notModified())
+	require.Equal(t, []string{"tcp://a:1234", "tcp://b:1234"}, signers.addresses())
+
+	handler.set(`[{"targets": ["tcp://a:1234"], "chainIDs": ["cosmoshub-4"]}, {"targets": ["tcp://c:1234"]}]`, `"v2"`)
+	require.NoError(t, refresh(ctx))
+	require.Equal(t, []string{"tcp://a:1234", "tcp://c:1234"}, signers.addresses())
+	require.Equal(t, 1, signers.startCount("tcp://a:1234"))
+
+	// the last good list is kept on errors
+	handler.set(`[{"targets": ["tcp://a:1234"], "chainIDs": ["cosmoshub-4"]}, {"target": ["tcp://c:1234"]}]`, `"v3"`)
+	require.ErrorContains(t, refresh(ctx), "unknown field")
+	handler.setStatus(http.StatusInternalServerError)
+	require.ErrorContains(t, refresh(ctx), "unexpected status 500")
+	require.NoError(t, os.WriteFile(authFile, []byte("Bearer wrong"), 0600))
+	handler.setStatus(0)
+	require.ErrorContains(t, refresh(ctx), "unexpected status 401")
+	srv.Close()
+	require.Error(t, refresh(ctx))
+	require.Equal(t, []string{"tcp://a:1234", "tcp://c:1234"}, signers.addresses())
+}
+
+func TestHTTPDiscoveryTLS(t *testing.T) {
+	ctx := context.Background()
+
+	handler := &sentryServer{}
+	handler.set(`[{"targets": ["tcp://a:1234"]}]`, "")
+	srv := httptest.NewTLSServer(handler)
+	t.Cleanup(srv.Close)
+
+	// the test server certificate is not trusted by the system roots
+	refresh, _ := newTestHTTPDiscovery(t, HTTPOptions{URL: srv.URL})
+	require.ErrorContains(t, refresh(ctx), "certificate")
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, ca, 0600))
+
+	refresh, signers := newTestHTTPDiscovery(t, HTTPOptions{URL: srv.URL, CAFile: caFile})
+	require.NoError(t, refresh(ctx))
+	require.Equal(t, []string{"tcp://a:1234"}, signers.addresses())
+
+	refresh, signers = newTestHTTPDiscovery(t, HTTPOptions{URL: srv.URL, InsecureSkipVerify: true})
+	require.NoError(t, refresh(ctx))
+	require.Equal(t, []string{"tcp://a:1234"}, signers.addresses())
+
+	_, err := newHTTPDiscovery(HTTPOptions{URL: srv.URL, CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+		defaultSentryConfig(1024), cometlog.NewNopLogger())
+	require.ErrorContains(t, err, "failed to read sentry URL CA file")
+}
+
+func TestSentryWatcherHTTP(t *testing.T) {
+	ctx := context.Background()
+
+	handler := &sentryServer{}
+	handler.set(`[{"targets": ["tcp://a:1234"]}]`, `"v1"`)
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	signers := newFakeSigners()
+	w, err := NewSentryWatcher(ctx, nil, cometlog.NewNopLogger(), false, nil, false, KubeOptions{}, nil, 1024,
+		SentryWatcherSignerFactory(signers.factory),
+		SentryWatcherHTTP(HTTPOptions{URL: srv.URL, Interval: 10 * time.Millisecond}),
+	)
+	require.NoError(t, err)
+
+	go w.Watch(ctx, 1024)
+	require.Eventually(t, func() bool {
+		return len(signers.addresses()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	handler.set(`[{"targets": ["tcp://a:1234", "tcp://b:1234"]}]`, `"v2"`)
+	require.Eventually(t, func() bool {
+		return len(signers.addresses()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, w.Stop())
+	require.Empty(t, signers.addresses())
+}
+
+func TestHTTPOptionsValidate(t *testing.T) {
+	require.NoError(t, HTTPOptions{URL: "https://inventory.example.com/sentries"}.validate())
+	require.ErrorContains(t, HTTPOptions{URL: "inventory.example.com/sentries"}.validate(), "invalid sentry URL")
+	require.ErrorContains(t, HTTPOptions{URL: "ftp://inventory.example.com"}.validate(), "invalid sentry URL")
+	require.ErrorContains(t, HTTPOptions{Interval: -time.Second}.validate(), "invalid sentry URL interval")
+	require.ErrorContains(t, HTTPOptions{CertFile: "cert.pem"}.validate(), "must be set together")
+}
@@ -0,0 +1,249 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// KubeOptions configure how the SentryWatcher connects to the kube api.
+type KubeOptions struct {
+	// Kubeconfig is the path of the kubeconfig file. If it and Context are
+	// empty, the in-cluster config of the pod's service account is used.
+	Kubeconfig string
+
+	// Context is the kubeconfig context to use instead of the current context.
+	Context string
+
+	// Client is the kube client to use instead of one built from Kubeconfig
+	// and Context, e.g. a fake clientset in tests. Its default namespace is the
+	// first of Namespaces, or metav1.NamespaceDefault.
+	Client kubernetes.Interface
+
+	// DynamicClient is the dynamic kube client to read CosmosFullNodes with
+	// in DiscoveryCRD mode, instead of one built from Kubeconfig and Context,
+	// e.g. a fake client in tests.
+	DynamicClient dynamic.Interface
+
+	// Node is the node to connect to sentries on. If empty, the node of this
+	// pod is looked up, which requires running in the cluster.
+	Node string
+
+	// TopologyKeys are node labels, narrowest first, of the topology domains
+	// to fall back to when there is no healthy sentry on this node.
+	// E.g. topology.kubernetes.io/zone, topology.kubernetes.io/region.
+	TopologyKeys []string
+
+	// Namespaces to discover sentries in. If empty, the namespace of the
+	// service account, or of the kubeconfig context, is used.
+	// metav1.NamespaceAll discovers sentries in all namespaces.
+	Namespaces []string
+
+	// Discovery is how sentries are discovered, DiscoveryLabels (default) or
+	// DiscoveryCRD.
+	Discovery string
+
+	// Shard splits the sentries across the proxy replicas of a group.
+	Shard ShardOptions
+
+	// Selector selects the sentry Services by label, in addition to the
+	// labels of each cluster.
+	Selector SelectorOptions
+
+	// ReadyGrace is how long a sentry pod must have been Ready before it is
+	// connected to.
+	ReadyGrace time.Duration
+
+	// Clusters are other clusters to discover sentries in, in addition to
+	// the local cluster.
+	Clusters []ClusterOptions
+}
+
+// ClusterOptions configure sentry discovery in another cluster.
+type ClusterOptions struct {
+	// Name identifies the cluster in logs and sentry identities.
+	Name string
+
+	// Kubeconfig is the path of the kubeconfig file of the cluster.
+	Kubeconfig string
+
+	// Context is the kubeconfig context to use instead of the current context.
+	Context string
+
+	// Labels select the sentry Services in the cluster, in addition to the
+	// cosmos-operator sentry label.
+	Labels []string
+}
+
+// inCluster reports whether the in-cluster config should be used.
+func (o KubeOptions) inCluster() bool {
+	return o.Kubeconfig == "" && o.Context == ""
+}
+
+// restConfig returns the kube client config and the default namespace.
+func (o KubeOptions) restConfig() (*rest.Config, string, error) {
+	if o.inCluster() {
+		config, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get in cluster config: %w", err)
+		}
+
+		nsbz, err := os.ReadFile(namespaceFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read namespace from service account: %w", err)
+		}
+
+		return config, strings.TrimSpace(string(nsbz)), nil
+	}
+
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: o.Kubeconfig},
+		&clientcmd.ConfigOverrides{CurrentContext: o.Context},
+	)
+
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	ns, _, err := clientConfig.Namespace()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get namespace from kubeconfig: %w", err)
+	}
+
+	return config, ns, nil
+}
+
+// newKubeClient returns a kube client and the default namespace for the options.
+func (o KubeOptions) newKubeClient() (kubernetes.Interface, string, error) {
+	if o.Client != nil {
+		ns := metav1.NamespaceDefault
+		if len(o.Namespaces) > 0 && o.Namespaces[0] != metav1.NamespaceAll {
+			ns = o.Namespaces[0]
+		}
+		return o.Client, ns, nil
+	}
+
+	config, ns, err := o.restConfig()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// creates the clientset
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create kube clientset: %w", err)
+	}
+
+	return clientset, ns, nil
+}
+
+// newDynamicClient returns a dynamic kube client for the options, used to read
+// custom resources.
+func (o KubeOptions) newDynamicClient() (dynamic.Interface, error) {
+	if o.DynamicClient != nil {
+		return o.DynamicClient, nil
+	}
+
+	config, _, err := o.restConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic kube client: %w", err)
+	}
+
+	return client, nil
+}
+
+// newCluster returns a kubeCluster that discovers sentries with the options,
+// and the default namespace.
+func (o KubeOptions) newCluster(
+	name string,
+	all bool,
+	labels []string,
+	logger cometlog.Logger,
+) (*kubeCluster, string, error) {
+	// CosmosFullNodes do not carry the sentry label of the Services that
+	// cosmos-operator creates, only the selectors of the options apply to them.
+	selectorOpts := o.Selector
+	if o.Discovery == DiscoveryCRD {
+		selectorOpts.NoDefault = true
+	}
+
+	// Validate the selectors before connecting, so a typo fails fast.
+	selector, err := newSentrySelector(labels, selectorOpts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	client, ns, err := o.newKubeClient()
+	if err != nil {
+		return nil, "", err
+	}
+
+	namespaces := o.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{ns}
+	}
+
+	c := &kubeCluster{
+		name:      name,
+		all:       all,
+		discovery: o.Discovery,
+		log:       logger,
+		selector:  selector,
+
+		readyGrace: o.ReadyGrace,
+	}
+
+	if err := c.setClient(client, namespaces); err != nil {
+		return nil, "", err
+	}
+
+	if o.Discovery == DiscoveryCRD {
+		dynamicClient, err := o.newDynamicClient()
+		if err != nil {
+			return nil, "", err
+		}
+		if err := c.setFullNodeClient(dynamicClient); err != nil {
+			return nil, "", err
+		}
+	}
+
+	// Start recording Events last, so that no broadcaster is left running
+	// when the cluster can't be set up.
+	c.events = newSentryEvents(client, os.Getenv("HOSTNAME"))
+
+	return c, ns, nil
+}
+
+// nodeName returns the configured node, or looks up the node this pod runs on.
+func (o KubeOptions) nodeName(ctx context.Context, client kubernetes.Interface, namespace string) (string, error) {
+	if o.Node != "" {
+		return o.Node, nil
+	}
+
+	if !o.inCluster() {
+		return "", errors.New("the node must be set explicitly when running outside of the cluster")
+	}
+
+	thisPod, err := client.CoreV1().Pods(namespace).Get(ctx, os.Getenv("HOSTNAME"), metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get this pod: %w", err)
+	}
+
+	return thisPod.Spec.NodeName, nil
+}
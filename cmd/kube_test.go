@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+  - name: bare-metal
+    cluster:
+      server: https://127.0.0.1:6443
+contexts:
+  - name: default
+    context:
+      cluster: bare-metal
+      user: proxy
+  - name: sentries
+    context:
+      cluster: bare-metal
+      user: proxy
+      namespace: sentries
+current-context: default
+users:
+  - name: proxy
+    user:
+      token: secret
+`
+
+func TestKubeOptionsRestConfig(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(kubeconfig, []byte(testKubeconfig), 0600))
+
+	tests := []struct {
+		name   string
+		opts   KubeOptions
+		wantNS string
+	}{
+		{name: "current context", opts: KubeOptions{Kubeconfig: kubeconfig}, wantNS: "default"},
+		{name: "explicit context", opts: KubeOptions{Kubeconfig: kubeconfig, Context: "sentries"}, wantNS: "sentries"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			config, ns, err := tt.opts.restConfig()
+			require.NoError(t, err)
+			require.Equal(t, "https://127.0.0.1:6443", config.Host)
+			require.Equal(t, tt.wantNS, ns)
+		})
+	}
+}
+
+func TestSentryWatcherClusterOptions(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(kubeconfig, []byte(testKubeconfig), 0600))
+
+	w, err := NewSentryWatcher(context.Background(), nil, cometlog.NewNopLogger(), false, nil, false, KubeOptions{
+		Namespaces: []string{"sentries"},
+		ReadyGrace: 30 * time.Second,
+		Clusters:   []ClusterOptions{{Name: "east", Kubeconfig: kubeconfig}},
+	}, nil, 1024)
+	require.NoError(t, err)
+
+	require.Len(t, w.clusters, 1)
+	east := w.clusters[0]
+	require.Equal(t, "east", east.name)
+	require.True(t, east.all)
+	require.Equal(t, 30*time.Second, east.readyGrace)
+	require.Len(t, east.informers, 1)
+	require.Equal(t, "sentries", east.informers[0].namespace)
+}
+
+func TestKubeOptionsNodeName(t *testing.T) {
+	t.Setenv("HOSTNAME", "horcrux-proxy-0")
+
+	client := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "horcrux-proxy-0", Namespace: "horcrux"},
+		Spec:       corev1.PodSpec{NodeName: "node-a"},
+	})
+
+	tests := []struct {
+		name    string
+		opts    KubeOptions
+		want    string
+		wantErr bool
+	}{
+		{name: "in cluster", opts: KubeOptions{}, want: "node-a"},
+		{name: "explicit node", opts: KubeOptions{Node: "node-b"}, want: "node-b"},
+		{name: "explicit node out of cluster", opts: KubeOptions{Kubeconfig: "config", Node: "node-b"}, want: "node-b"},
+		{name: "out of cluster without node", opts: KubeOptions{Kubeconfig: "config"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := tt.opts.nodeName(context.Background(), client, "horcrux")
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, node)
+		})
+	}
+}
+
+func TestParseClusterOptions(t *testing.T) {
+	opts, err := parseClusterOptions(
+		[]string{"east=/etc/kube/east.yaml", "west=/etc/kube/west.yaml"},
+		[]string{"east=prod"},
+		[]string{"west=region=west", "west=tier=sentry"},
+	)
+	require.NoError(t, err)
+	require.Equal(t, []ClusterOptions{
+		{Name: "east", Kubeconfig: "/etc/kube/east.yaml", Context: "prod"},
+		{Name: "west", Kubeconfig: "/etc/kube/west.yaml", Labels: []string{"region=west", "tier=sentry"}},
+	}, opts)
+
+	for _, tt := range []struct {
+		name                       string
+		clusters, contexts, labels []string
+	}{
+		{name: "missing kubeconfig", clusters: []string{"east"}},
+		{name: "duplicate cluster", clusters: []string{"east=a", "east=b"}},
+		{name: "context of unknown cluster", clusters: []string{"east=a"}, contexts: []string{"west=prod"}},
+		{name: "empty label", clusters: []string{"east=a"}, labels: []string{"east="}},
+	} {
+		_, err := parseClusterOptions(tt.clusters, tt.contexts, tt.labels)
+		require.Error(t, err, tt.name)
+	}
+}
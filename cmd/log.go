@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+)
+
+// Log levels, in increasing order of severity.
+const (
+	logLevelDebug int32 = iota
+	logLevelInfo
+	logLevelError
+	logLevelNone
+)
+
+// parseLogLevel parses a log level as accepted by cometlog.AllowLevel.
+func parseLogLevel(level string) (int32, error) {
+	switch level {
+	case "debug":
+		return logLevelDebug, nil
+	case "info":
+		return logLevelInfo, nil
+	case "error":
+		return logLevelError, nil
+	case "none":
+		return logLevelNone, nil
+	default:
+		return 0, fmt.Errorf(`expected either "info", "debug", "error" or "none" level, given %s`, level)
+	}
+}
+
+// levelLogger is a cometlog.Logger whose level can be changed at runtime, e.g.
+// when the config file is reloaded. Loggers derived with With share the level.
+type levelLogger struct {
+	next  cometlog.Logger
+	level *atomic.Int32
+}
+
+var _ cometlog.Logger = (*levelLogger)(nil)
+
+// newLevelLogger returns a levelLogger that filters the logs of next by level.
+func newLevelLogger(next cometlog.Logger, level string) (*levelLogger, error) {
+	l := &levelLogger{next: next, level: new(atomic.Int32)}
+	if err := l.SetLevel(level); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// SetLevel changes the level of the logger and of the loggers derived from it.
+func (l *levelLogger) SetLevel(level string) error {
+	lvl, err := parseLogLevel(level)
+	if err != nil {
+		return err
+	}
+	l.level.Store(lvl)
+	return nil
+}
+
+func (l *levelLogger) Debug(msg string, keyvals ...any) {
+	if l.level.Load() <= logLevelDebug {
+		l.next.Debug(msg, keyvals...)
+	}
+}
+
+func (l *levelLogger) Info(msg string, keyvals ...any) {
+	if l.level.Load() <= logLevelInfo {
+		l.next.Info(msg, keyvals...)
+	}
+}
+
+func (l *levelLogger) Error(msg string, keyvals ...any) {
+	if l.level.Load() <= logLevelError {
+		l.next.Error(msg, keyvals...)
+	}
+}
+
+func (l *levelLogger) With(keyvals ...any) cometlog.Logger {
+	return &levelLogger{next: l.next.With(keyvals...), level: l.level}
+}
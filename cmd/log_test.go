@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevelLogger(t *testing.T) {
+	var buf bytes.Buffer
+	levels, err := newLevelLogger(cometlog.NewTMLogger(&buf), "info")
+	require.NoError(t, err)
+	logger := levels.With("module", "test")
+
+	logger.Debug("debug 1")
+	logger.Info("info 1")
+	require.NotContains(t, buf.String(), "debug 1")
+	require.Contains(t, buf.String(), "info 1")
+	require.Contains(t, buf.String(), "module=test")
+
+	// derived loggers follow the level
+	require.NoError(t, levels.SetLevel("debug"))
+	logger.Debug("debug 2")
+	require.Contains(t, buf.String(), "debug 2")
+
+	require.NoError(t, levels.SetLevel("error"))
+	logger.Info("info 2")
+	logger.Error("error 1")
+	require.NotContains(t, buf.String(), "info 2")
+	require.Contains(t, buf.String(), "error 1")
+
+	require.NoError(t, levels.SetLevel("none"))
+	logger.Error("error 2")
+	require.NotContains(t, buf.String(), "error 2")
+
+	require.Error(t, levels.SetLevel("loud"))
+	_, err = newLevelLogger(cometlog.NewNopLogger(), "loud")
+	require.Error(t, err)
+}
@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	flagServiceAccount          = "service-account"
+	flagServiceAccountNamespace = "service-account-namespace"
+	flagTopology                = "topology"
+	flagShard                   = "shard"
+)
+
+var rbacTemplate = template.Must(template.New("rbac").Parse(`{{- range .Namespaces }}
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: {{ $.Name }}
+  namespace: {{ . }}
+rules:
+  - apiGroups: [""]
+    resources: ["services", "pods"]
+    verbs: ["get", "list", "watch"]
+  - apiGroups: [""]
+    resources: ["events"]
+    verbs: ["create", "patch"]
+{{- if $.FullNodes }}
+  - apiGroups: ["cosmos.strange.love"]
+    resources: ["cosmosfullnodes"]
+    verbs: ["get", "list", "watch"]
+{{- end }}
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: {{ $.Name }}
+  namespace: {{ . }}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: {{ $.Name }}
+subjects:
+  - kind: ServiceAccount
+    name: {{ $.ServiceAccount }}
+    namespace: {{ $.ServiceAccountNamespace }}
+{{- end }}
+{{- if .SelfRole }}
+---
+# Allows the proxy to look up its own pod to find the node it runs on.
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: {{ .Name }}-self
+  namespace: {{ .ServiceAccountNamespace }}
+rules:
+  - apiGroups: [""]
+    resources: ["pods"]
+    verbs: ["get"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: {{ .Name }}-self
+  namespace: {{ .ServiceAccountNamespace }}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: {{ .Name }}-self
+subjects:
+  - kind: ServiceAccount
+    name: {{ .ServiceAccount }}
+    namespace: {{ .ServiceAccountNamespace }}
+{{- end }}
+{{- if .Shard }}
+---
+# Allows the proxy replicas to coordinate sentry sharding with Leases.
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: {{ .Name }}-shard
+  namespace: {{ .ServiceAccountNamespace }}
+rules:
+  - apiGroups: ["coordination.k8s.io"]
+    resources: ["leases"]
+    verbs: ["get", "list", "watch", "create", "update", "delete"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: {{ .Name }}-shard
+  namespace: {{ .ServiceAccountNamespace }}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: {{ .Name }}-shard
+subjects:
+  - kind: ServiceAccount
+    name: {{ .ServiceAccount }}
+    namespace: {{ .ServiceAccountNamespace }}
+{{- end }}
+{{- if .Nodes }}
+---
+# Allows the proxy to read node labels for topology-aware sentry selection.
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: {{ .Name }}-nodes
+rules:
+  - apiGroups: [""]
+    resources: ["nodes"]
+    verbs: ["get", "list", "watch"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: {{ .Name }}-nodes
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: {{ .Name }}-nodes
+subjects:
+  - kind: ServiceAccount
+    name: {{ .ServiceAccount }}
+    namespace: {{ .ServiceAccountNamespace }}
+{{- end }}
+{{- if .ClusterWide }}
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: {{ .Name }}
+rules:
+  - apiGroups: [""]
+    resources: ["services", "pods"]
+    verbs: ["get", "list", "watch"]
+  - apiGroups: [""]
+    resources: ["events"]
+    verbs: ["create", "patch"]
+{{- if $.FullNodes }}
+  - apiGroups: ["cosmos.strange.love"]
+    resources: ["cosmosfullnodes"]
+    verbs: ["get", "list", "watch"]
+{{- end }}
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: {{ .Name }}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: {{ .Name }}
+subjects:
+  - kind: ServiceAccount
+    name: {{ .ServiceAccount }}
+    namespace: {{ .ServiceAccountNamespace }}
+{{- end }}
+`))
+
+type rbacValues struct {
+	Name                    string
+	Namespaces              []string
+	ServiceAccount          string
+	ServiceAccountNamespace string
+	SelfRole                bool
+	Nodes                   bool
+	ClusterWide             bool
+	FullNodes               bool
+	Shard                   bool
+}
+
+// rbacCmd prints sample RBAC manifests for sentry discovery.
+func rbacCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rbac",
+		Short: "Print a sample Role and RoleBinding for sentry discovery",
+		Long: `Print sample RBAC manifests that grant the horcrux-proxy service account the
+permissions needed to discover sentries in the given namespaces.
+
+With --all-namespaces, a ClusterRole and ClusterRoleBinding are printed instead.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			namespaces, _ := cmd.Flags().GetStringArray(flagNamespace)
+			allNamespaces, _ := cmd.Flags().GetBool(flagAllNamespaces)
+			sa, _ := cmd.Flags().GetString(flagServiceAccount)
+			saNamespace, _ := cmd.Flags().GetString(flagServiceAccountNamespace)
+			topology, _ := cmd.Flags().GetBool(flagTopology)
+			discovery, _ := cmd.Flags().GetString(flagDiscovery)
+			shard, _ := cmd.Flags().GetBool(flagShard)
+
+			if saNamespace == "" {
+				return fmt.Errorf("--%s is required", flagServiceAccountNamespace)
+			}
+
+			values := rbacValues{
+				Name:                    "horcrux-proxy",
+				ServiceAccount:          sa,
+				ServiceAccountNamespace: saNamespace,
+				Nodes:                   topology,
+				ClusterWide:             allNamespaces,
+				FullNodes:               discovery == DiscoveryCRD,
+				Shard:                   shard,
+			}
+
+			if !allNamespaces {
+				if len(namespaces) == 0 {
+					namespaces = []string{saNamespace}
+				}
+				values.Namespaces = uniqueNamespaces(namespaces)
+				values.SelfRole = true
+				for _, ns := range values.Namespaces {
+					if ns == saNamespace {
+						values.SelfRole = false
+					}
+				}
+			}
+
+			var sb strings.Builder
+			if err := rbacTemplate.Execute(&sb, values); err != nil {
+				return err
+			}
+			_, err := fmt.Fprintln(cmd.OutOrStdout(), strings.TrimSpace(sb.String()))
+			return err
+		},
+	}
+
+	cmd.Flags().StringArrayP(flagNamespace, "n", nil, "Namespace(s) to discover sentries in (default the service account namespace)")
+	cmd.Flags().Bool(flagAllNamespaces, false, "Print a ClusterRole to discover sentries in all namespaces")
+	cmd.Flags().Bool(flagTopology, false, "Also print a ClusterRole to read node labels, required by --topology-key")
+	cmd.Flags().Bool(flagShard, false, "Also print a Role to manage the Leases used by --shard-group")
+	cmd.Flags().String(flagDiscovery, DiscoveryLabels, "Discovery mode of the proxy, crd also grants access to CosmosFullNode resources")
+	cmd.Flags().String(flagServiceAccount, "horcrux-proxy", "Name of the horcrux-proxy service account")
+	cmd.Flags().String(flagServiceAccountNamespace, "", "Namespace of the horcrux-proxy service account")
+
+	return cmd
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// rbacManifests are the manifests printed by the rbac command, by kind and
+// namespace/name.
+type rbacManifests struct {
+	roles               map[string]rbacv1.Role
+	roleBindings        map[string]rbacv1.RoleBinding
+	clusterRoles        map[string]rbacv1.ClusterRole
+	clusterRoleBindings map[string]rbacv1.ClusterRoleBinding
+}
+
+func runRBAC(t *testing.T, args ...string) rbacManifests {
+	cmd := rbacCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs(args)
+	require.NoError(t, cmd.Execute())
+
+	m := rbacManifests{
+		roles:               make(map[string]rbacv1.Role),
+		roleBindings:        make(map[string]rbacv1.RoleBinding),
+		clusterRoles:        make(map[string]rbacv1.ClusterRole),
+		clusterRoleBindings: make(map[string]rbacv1.ClusterRoleBinding),
+	}
+	for _, doc := range strings.Split(out.String(), "\n---\n") {
+		bz := []byte(strings.TrimPrefix(doc, "---\n"))
+		var typ metav1.TypeMeta
+		require.NoError(t, yaml.Unmarshal(bz, &typ))
+		switch typ.Kind {
+		case "Role":
+			var r rbacv1.Role
+			require.NoError(t, yaml.UnmarshalStrict(bz, &r))
+			m.roles[r.Namespace+"/"+r.Name] = r
+		case "RoleBinding":
+			var b rbacv1.RoleBinding
+			require.NoError(t, yaml.UnmarshalStrict(bz, &b))
+			m.roleBindings[b.Namespace+"/"+b.Name] = b
+		case "ClusterRole":
+			var r rbacv1.ClusterRole
+			require.NoError(t, yaml.UnmarshalStrict(bz, &r))
+			m.clusterRoles[r.Name] = r
+		case "ClusterRoleBinding":
+			var b rbacv1.ClusterRoleBinding
+			require.NoError(t, yaml.UnmarshalStrict(bz, &b))
+			m.clusterRoleBindings[b.Name] = b
+		default:
+			t.Fatalf("unexpected manifest kind %q", typ.Kind)
+		}
+	}
+	return m
+}
+
+func TestRBACNamespaces(t *testing.T) {
+	m := runRBAC(t, "--service-account-namespace", "horcrux", "-n", "chain-a", "-n", "chain-b", "-n", "chain-a", "--discovery", "crd")
+
+	discovery := []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"services", "pods"}, Verbs: []string{"get", "list", "watch"}},
+		{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"create", "patch"}},
+		{APIGroups: []string{"cosmos.strange.love"}, Resources: []string{"cosmosfullnodes"}, Verbs: []string{"get", "list", "watch"}},
+	}
+	subjects := []rbacv1.Subject{{Kind: "ServiceAccount", Name: "horcrux-proxy", Namespace: "horcrux"}}
+
+	require.Len(t, m.roles, 3)
+	require.Len(t, m.roleBindings, 3)
+	for _, ns := range []string{"chain-a", "chain-b"} {
+		role, ok := m.roles[ns+"/horcrux-proxy"]
+		require.True(t, ok, ns)
+		require.Equal(t, discovery, role.Rules)
+
+		binding, ok := m.roleBindings[ns+"/horcrux-proxy"]
+		require.True(t, ok, ns)
+		require.Equal(t, rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "Role", Name: "horcrux-proxy"}, binding.RoleRef)
+		require.Equal(t, subjects, binding.Subjects)
+	}
+
+	// The proxy's own namespace is not discovered, so it gets a Role to look
+	// up its own pod.
+	self, ok := m.roles["horcrux/horcrux-proxy-self"]
+	require.True(t, ok)
+	require.Equal(t, []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}}, self.Rules)
+	require.Equal(t, subjects, m.roleBindings["horcrux/horcrux-proxy-self"].Subjects)
+	require.Equal(t, "horcrux-proxy-self", m.roleBindings["horcrux/horcrux-proxy-self"].RoleRef.Name)
+
+	require.Empty(t, m.clusterRoles)
+	require.Empty(t, m.clusterRoleBindings)
+}
+
+func TestRBACServiceAccountNamespace(t *testing.T) {
+	m := runRBAC(t, "--service-account-namespace", "horcrux", "--topology", "--shard")
+
+	require.Len(t, m.roles, 2)
+	role, ok := m.roles["horcrux/horcrux-proxy"]
+	require.True(t, ok, "defaults to the service account namespace, which needs no self Role")
+	require.Len(t, role.Rules, 2, "no CosmosFullNode access with label discovery")
+
+	shard, ok := m.roles["horcrux/horcrux-proxy-shard"]
+	require.True(t, ok)
+	require.Equal(t, []string{"coordination.k8s.io"}, shard.Rules[0].APIGroups)
+	require.Equal(t, []string{"leases"}, shard.Rules[0].Resources)
+
+	nodes, ok := m.clusterRoles["horcrux-proxy-nodes"]
+	require.True(t, ok)
+	require.Equal(t, []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"get", "list", "watch"}}}, nodes.Rules)
+	require.Equal(t, "horcrux", m.clusterRoleBindings["horcrux-proxy-nodes"].Subjects[0].Namespace)
+}
+
+func TestRBACAllNamespaces(t *testing.T) {
+	m := runRBAC(t, "--service-account-namespace", "horcrux", "--all-namespaces", "-n", "chain-a")
+
+	require.Empty(t, m.roles)
+	require.Empty(t, m.roleBindings)
+	require.Len(t, m.clusterRoles, 1)
+	require.Len(t, m.clusterRoles["horcrux-proxy"].Rules, 2)
+	require.Equal(t, "ClusterRole", m.clusterRoleBindings["horcrux-proxy"].RoleRef.Kind)
+}
+
+func TestRBACRequiresServiceAccountNamespace(t *testing.T) {
+	cmd := rbacCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs(nil)
+	require.ErrorContains(t, cmd.Execute(), "--service-account-namespace is required")
+}
@@ -0,0 +1,584 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/strangelove-ventures/horcrux-proxy/signer"
+)
+
+// Sources of sentries, in order of precedence: if several sources discover the
+// same sentry, the settings of the first one are used.
+const (
+	sourceAPI    = "api"
+	sourceStatic = "static"
+	sourceKube   = "kubernetes"
+	sourceFile   = "file"
+	sourceHTTP   = "http"
+	sourceDNS    = "dns"
+)
+
+// defaultStartRetryInterval is how long after a remote signer failed to start
+// it is started again, unless its source is updated in the meantime.
+const defaultStartRetryInterval = 5 * time.Second
+
+// Discoverer is a source of sentries, e.g. the kube api or sentry files.
+type Discoverer interface {
+	// Name identifies the source of the sentries, e.g. in logs.
+	Name() string
+
+	// Run discovers sentries until stop is closed or ctx is done. Whenever the
+	// sentries may have changed, it calls update with the complete set of
+	// sentries of the source.
+	Run(ctx context.Context, stop <-chan struct{}, update SentryUpdate)
+}
+
+// SentryUpdate replaces the sentries of a Discoverer, keyed by address, or by
+// cluster/address for sentries of other clusters. It returns the errors of the
+// sentries whose remote signer failed to start or stop, by the same keys.
+type SentryUpdate func(sentries map[string]desiredSentry) map[string]error
+
+// desiredSentry is a sentry that a Discoverer wants to be connected to.
+type desiredSentry struct {
+	address string
+	config  sentryConfig
+
+	// log is the logger of the remote signer of the sentry.
+	log cometlog.Logger
+
+	// endpoint is the pod of a sentry discovered through the kube api, that
+	// Events are recorded against. It is nil for other sources.
+	endpoint *sentryEndpoint
+}
+
+// desiredSentries returns the sentries of the configs, keyed by address.
+func desiredSentries(configs map[string]sentryConfig, logger cometlog.Logger) map[string]desiredSentry {
+	sentries := make(map[string]desiredSentry, len(configs))
+	for address, config := range configs {
+		sentries[address] = desiredSentry{address: address, config: config, log: logger}
+	}
+	return sentries
+}
+
+// reconciledSentry is a sentry of the merged sources and its remote signer.
+type reconciledSentry struct {
+	desiredSentry
+
+	// source is the source whose settings are used, sources are all the
+	// sources that discovered the sentry.
+	source  string
+	sources []string
+
+	signer RemoteSigner
+	stats  *sentryStats
+
+	// removeAt is when the sentry is removed, if its sources no longer
+	// discover it and it is within the removal grace.
+	removeAt time.Time
+}
+
+// logKeyvals returns the keyvals that identify the sentry in logs.
+func (s *reconciledSentry) logKeyvals() []any {
+	keyvals := []any{"address", s.address, "source", s.source}
+	if e := s.endpoint; e != nil {
+		keyvals = append(keyvals, "namespace", e.namespace, "pod", e.pod, "node", e.node)
+	}
+	return keyvals
+}
+
+// errUnknownSentry is returned for a sentry that no source discovered.
+var errUnknownSentry = errors.New("unknown sentry")
+
+// sentryReconciler merges the sentries of several sources and runs a remote
+// signer for each of them. A sentry discovered by several sources is connected
+// to once. When the sentries of a source change, only the signers of sentries
+// that were added, removed or reconfigured are started or stopped, the
+// connections to the others are kept.
+type sentryReconciler struct {
+	hc        signer.HorcruxConnection
+	log       cometlog.Logger
+	newSigner SignerFactory
+
+	mu       sync.Mutex
+	sources  []string
+	desired  map[string]map[string]desiredSentry
+	sentries map[string]*reconciledSentry
+	started  bool
+
+	// drained are the sentries that are kept disconnected, whatever their sources.
+	drained map[string]bool
+
+	// While paused, the updates of discovery sources are held in pending
+	// instead of being applied.
+	paused  bool
+	pending map[string]map[string]desiredSentry
+
+	// removalGrace is how long sentries that are no longer discovered stay
+	// connected. retryInterval is how long after failing to start a sentry is
+	// retried. reconcileTimer reconciles at reconcileAt, when the first removal
+	// or retry is due.
+	removalGrace   time.Duration
+	retryInterval  time.Duration
+	reconcileTimer *time.Timer
+	reconcileAt    time.Time
+	now            func() time.Time
+}
+
+// newSentryReconciler returns a sentryReconciler of the sources, in order of
+// precedence. Other sources are added after them when they are first updated.
+func newSentryReconciler(
+	hc signer.HorcruxConnection,
+	logger cometlog.Logger,
+	newSigner SignerFactory,
+	sources ...string,
+) *sentryReconciler {
+	return &sentryReconciler{
+		hc:        hc,
+		log:       logger,
+		newSigner: newSigner,
+		sources:   sources,
+		desired:   make(map[string]map[string]desiredSentry),
+		sentries:  make(map[string]*reconciledSentry),
+		drained:   make(map[string]bool),
+		pending:   make(map[string]map[string]desiredSentry),
+
+		retryInterval: defaultStartRetryInterval,
+	}
+}
+
+// updater returns the SentryUpdate of the source.
+func (r *sentryReconciler) updater(source string) SentryUpdate {
+	return func(sentries map[string]desiredSentry) map[string]error {
+		return r.update(source, sentries)
+	}
+}
+
+// update replaces the sentries of the source. The signers are only started or
+// stopped if the reconciler is started.
+func (r *sentryReconciler) update(source string, sentries map[string]desiredSentry) map[string]error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.hasSource(source) {
+		r.sources = append(r.sources, source)
+	}
+	if r.paused && discoverySource(source) {
+		r.pending[source] = sentries
+		return nil
+	}
+	r.desired[source] = sentries
+
+	return r.reconcileIfStarted()
+}
+
+// add adds a sentry to those of the source, or replaces it.
+func (r *sentryReconciler) add(source, key string, s desiredSentry) map[string]error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.hasSource(source) {
+		r.sources = append(r.sources, source)
+	}
+	sentries := make(map[string]desiredSentry, len(r.desired[source])+1)
+	for k, existing := range r.desired[source] {
+		sentries[k] = existing
+	}
+	sentries[key] = s
+	r.desired[source] = sentries
+
+	return r.reconcileIfStarted()
+}
+
+// remove removes a sentry from those of the source. It returns
+// errUnknownSentry if the source has no such sentry.
+func (r *sentryReconciler) remove(source, key string) (map[string]error, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.desired[source][key]; !exists {
+		return nil, errUnknownSentry
+	}
+	sentries := make(map[string]desiredSentry, len(r.desired[source]))
+	for k, existing := range r.desired[source] {
+		if k != key {
+			sentries[k] = existing
+		}
+	}
+	r.desired[source] = sentries
+
+	return r.reconcileIfStarted(), nil
+}
+
+// drain disconnects a sentry and keeps it disconnected until it is undrained,
+// even if it is rediscovered. It returns errUnknownSentry if no source
+// discovered the sentry.
+func (r *sentryReconciler) drain(key string) (map[string]error, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, discovered := r.merged()[key]
+	if _, connected := r.sentries[key]; !discovered && !connected {
+		return nil, errUnknownSentry
+	}
+	r.drained[key] = true
+	return r.reconcileIfStarted(), nil
+}
+
+// undrain reconnects a drained sentry. It returns errUnknownSentry if the
+// sentry is not drained.
+func (r *sentryReconciler) undrain(key string) (map[string]error, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.drained[key] {
+		return nil, errUnknownSentry
+	}
+	delete(r.drained, key)
+	return r.reconcileIfStarted(), nil
+}
+
+// disconnect closes the connection to a sentry, which is redialed by a new
+// remote signer. It returns errUnknownSentry if the sentry has no running
+// remote signer.
+func (r *sentryReconciler) disconnect(key string) (map[string]error, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, exists := r.sentries[key]
+	if !exists {
+		return nil, errUnknownSentry
+	}
+	s.log.Info("Will reconnect sentry", s.logKeyvals()...)
+	errs := make(map[string]error)
+	if err := s.signer.Stop(); err != nil {
+		errs[key] = fmt.Errorf("failed to stop remote signer: %w", err)
+	}
+	delete(r.sentries, key)
+	for k, err := range r.reconcileIfStarted() {
+		errs[k] = err
+	}
+	return errs, nil
+}
+
+// discoverySource reports whether the source discovers sentries, as opposed to
+// the config and the admin API. The updates of discovery sources are held while
+// discovery is paused, and their sentries are removed after the removal grace.
+func discoverySource(source string) bool {
+	return source != sourceStatic && source != sourceAPI
+}
+
+// pause holds the updates of the discovery sources until resume is called, so
+// their sentries stay as they are.
+func (r *sentryReconciler) pause() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.paused = true
+}
+
+// resume applies the updates of the discovery sources held since pause.
+func (r *sentryReconciler) resume() map[string]error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.paused = false
+	for source, sentries := range r.pending {
+		r.desired[source] = sentries
+		delete(r.pending, source)
+	}
+	return r.reconcileIfStarted()
+}
+
+// isPaused reports whether discovery is paused.
+func (r *sentryReconciler) isPaused() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.paused
+}
+
+// reconcileIfStarted reconciles the signers if the reconciler is started.
+func (r *sentryReconciler) reconcileIfStarted() map[string]error {
+	if !r.started {
+		return nil
+	}
+	return r.reconcile()
+}
+
+func (r *sentryReconciler) hasSource(source string) bool {
+	for _, s := range r.sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+// merged returns the sentries of all the sources, without signers.
+func (r *sentryReconciler) merged() map[string]*reconciledSentry {
+	merged := make(map[string]*reconciledSentry)
+	for _, source := range r.sources {
+		for key, s := range r.desired[source] {
+			if m, exists := merged[key]; exists {
+				m.sources = append(m.sources, source)
+				continue
+			}
+			merged[key] = &reconciledSentry{desiredSentry: s, source: source, sources: []string{source}}
+		}
+	}
+	return merged
+}
+
+// reconcile starts and stops remote signers to match the sentries of the
+// sources. Sentries that failed to start are retried on the next update, or
+// after the retry interval, whichever comes first. Without the retry, a static
+// sentry would not be retried until the config is reloaded.
+func (r *sentryReconciler) reconcile() map[string]error {
+	errs := make(map[string]error)
+	merged := r.merged()
+	for key := range r.drained {
+		delete(merged, key)
+	}
+
+	if r.reconcileTimer != nil {
+		r.reconcileTimer.Stop()
+		r.reconcileTimer = nil
+	}
+	now := time.Now()
+	if r.now != nil {
+		now = r.now()
+	}
+
+	var added, stopped []string
+	for key, m := range merged {
+		existing, exists := r.sentries[key]
+		switch {
+		case !exists:
+			m.log.Info("Will add new sentry", m.logKeyvals()...)
+			if e := m.endpoint; e != nil {
+				e.cluster.events.record(*e, corev1.EventTypeNormal, eventReasonDiscovered, "Discovered sentry at %s, connecting", e.address)
+			}
+			added = append(added, key)
+		case !existing.config.equal(m.config):
+			m.log.Info("Will reconnect reconfigured sentry", m.logKeyvals()...)
+			stopped = append(stopped, key)
+			added = append(added, key)
+		default:
+			if !existing.removeAt.IsZero() {
+				m.log.Info("Sentry is discovered again, cancelled its removal", m.logKeyvals()...)
+			}
+			existing.desiredSentry = m.desiredSentry
+			existing.source, existing.sources = m.source, m.sources
+			existing.removeAt = time.Time{}
+		}
+	}
+
+	for key, s := range r.sentries {
+		if _, exists := merged[key]; exists {
+			continue
+		}
+		if r.drained[key] {
+			s.log.Info("Will drain sentry", s.logKeyvals()...)
+			stopped = append(stopped, key)
+			continue
+		}
+		if r.inRemovalGrace(s, now) {
+			continue
+		}
+		s.log.Info("Will remove existing sentry", s.logKeyvals()...)
+		if e := s.endpoint; e != nil {
+			e.cluster.events.record(*e, corev1.EventTypeNormal, eventReasonRemoved,
+				"Sentry at %s is no longer discovered, disconnecting", e.address)
+		}
+		stopped = append(stopped, key)
+	}
+
+	for _, key := range stopped {
+		if err := r.sentries[key].signer.Stop(); err != nil {
+			errs[key] = fmt.Errorf("failed to stop remote signer: %w", err)
+		}
+		delete(r.sentries, key)
+	}
+
+	// Connect to the sentries with the highest priority first.
+	sort.Slice(added, func(i, j int) bool {
+		pi, pj := merged[added[i]].config.priority, merged[added[j]].config.priority
+		if pi != pj {
+			return pi > pj
+		}
+		return added[i] < added[j]
+	})
+
+	for _, key := range added {
+		m := merged[key]
+		m.stats = newSentryStats()
+		handler := m.stats.handle
+		if e := m.endpoint; e != nil {
+			events := e.cluster.events.handler(*e)
+			handler = func(event signer.RemoteSignerEvent, err error) {
+				m.stats.handle(event, err)
+				events(event, err)
+			}
+		}
+		m.signer = m.config.newRemoteSigner(r.newSigner, m.address, m.log, r.hc, signer.ReconnRemoteSignerEventHandler(handler))
+		if err := m.signer.Start(); err != nil {
+			// Not added, so it is retried on the next reconcile.
+			errs[key] = fmt.Errorf("failed to start remote signer: %w", err)
+			r.scheduleReconcile(now, now.Add(r.retryInterval))
+			continue
+		}
+		r.sentries[key] = m
+	}
+
+	return errs
+}
+
+// inRemovalGrace reports whether a sentry that is no longer discovered stays
+// connected, because it may only be missing from a list result for a moment,
+// e.g. during an operator reconcile or an API server blip. A reconcile is
+// scheduled for when its grace has passed. Sentries that were removed from the
+// config or through the admin API, sentries whose pod is gone or being
+// deleted, and sentries that the shard assigns to another replica, are removed
+// right away.
+func (r *sentryReconciler) inRemovalGrace(s *reconciledSentry, now time.Time) bool {
+	if r.removalGrace <= 0 {
+		return false
+	}
+	for _, source := range s.sources {
+		if !discoverySource(source) {
+			return false
+		}
+	}
+	if e := s.endpoint; e != nil && (e.cluster.podGone(*e) || e.cluster.shardDropped(*e)) {
+		return false
+	}
+
+	if s.removeAt.IsZero() {
+		s.removeAt = now.Add(r.removalGrace)
+		s.log.Info("Sentry is no longer discovered, will remove it after the removal grace",
+			append(s.logKeyvals(), "grace", r.removalGrace)...)
+	}
+	if !now.Before(s.removeAt) {
+		return false
+	}
+	r.scheduleReconcile(now, s.removeAt)
+	return true
+}
+
+// scheduleReconcile requests a reconcile at the time, unless one is scheduled
+// earlier.
+func (r *sentryReconciler) scheduleReconcile(now, at time.Time) {
+	if r.reconcileTimer != nil {
+		if !r.reconcileAt.After(at) {
+			return
+		}
+		r.reconcileTimer.Stop()
+	}
+	r.reconcileAt = at
+	r.reconcileTimer = time.AfterFunc(at.Sub(now), func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if !r.started {
+			return
+		}
+		if err := (ReconcileResult{Errors: r.reconcile()}).Err(); err != nil {
+			r.log.Error("Failed to reconcile sentries", "error", err)
+		}
+	})
+}
+
+// start starts the signers. Sentries updated afterwards are started right away.
+func (r *sentryReconciler) start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.started = true
+	if err := (ReconcileResult{Errors: r.reconcile()}).Err(); err != nil {
+		r.log.Error("Failed to start sentries", "error", err)
+	}
+}
+
+// stop stops the signers. Sentries updated afterwards are not started.
+func (r *sentryReconciler) stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.started = false
+	if r.reconcileTimer != nil {
+		r.reconcileTimer.Stop()
+		r.reconcileTimer = nil
+	}
+	var err error
+	for key, s := range r.sentries {
+		err = errors.Join(err, s.signer.Stop())
+		delete(r.sentries, key)
+	}
+	return err
+}
+
+// status returns the status of the sentries of all the sources, sorted by key.
+func (r *sentryReconciler) status() []SentryStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	merged := r.merged()
+	for key, s := range r.sentries {
+		if _, exists := merged[key]; !exists {
+			// No longer discovered, but within the removal grace.
+			merged[key] = s
+		}
+	}
+	keys := make([]string, 0, len(merged))
+	for key := range merged {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	status := make([]SentryStatus, len(keys))
+	for i, key := range keys {
+		m := merged[key]
+		status[i] = SentryStatus{
+			Address:  key,
+			Source:   m.source,
+			Sources:  m.sources,
+			ChainIDs: m.config.chainIDs,
+			State:    SentryFailed,
+		}
+		switch s, exists := r.sentries[key]; {
+		case r.drained[key]:
+			status[i].State = SentryDrained
+		case exists:
+			status[i].State, status[i].Stats = s.stats.get()
+			if !s.removeAt.IsZero() {
+				removeAt := s.removeAt
+				status[i].RemoveAt = &removeAt
+			}
+		}
+	}
+	return status
+}
+
+// count returns the number of sentries of the source with a running signer.
+func (r *sentryReconciler) count(source string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for _, s := range r.sentries {
+		for _, src := range s.sources {
+			if src == source {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
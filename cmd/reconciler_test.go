@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestReconciler returns a started sentryReconciler of the fake signers.
+func newTestReconciler(t *testing.T, signers *fakeSigners) *sentryReconciler {
+	r := newSentryReconciler(nil, cometlog.NewNopLogger(), signers.factory,
+		sourceStatic, sourceKube, sourceFile, sourceHTTP, sourceDNS)
+	r.start()
+	t.Cleanup(func() { _ = r.stop() })
+	return r
+}
+
+func TestSentryReconciler(t *testing.T) {
+	signers := newFakeSigners()
+	r := newTestReconciler(t, signers)
+	logger := cometlog.NewNopLogger()
+	defaults := defaultSentryConfig(1024)
+	reconfigured := defaults
+	reconfigured.dialTimeout = 5 * time.Second
+
+	require.Empty(t, r.update(sourceDNS, desiredSentries(map[string]sentryConfig{
+		"tcp://a:1234": defaults,
+		"tcp://b:1234": defaults,
+	}, logger)))
+	require.Empty(t, r.update(sourceFile, desiredSentries(map[string]sentryConfig{
+		"tcp://b:1234": defaults,
+		"tcp://c:1234": defaults,
+	}, logger)))
+
+	// a sentry of several sources is connected to once
+	require.Equal(t, []string{"tcp://a:1234", "tcp://b:1234", "tcp://c:1234"}, signers.addresses())
+	require.Equal(t, 1, signers.startCount("tcp://b:1234"))
+	require.Equal(t, sourceFile, r.sentries["tcp://b:1234"].source)
+	require.Equal(t, []string{sourceFile, sourceDNS}, r.sentries["tcp://b:1234"].sources)
+	require.Equal(t, 2, r.count(sourceDNS))
+
+	// the settings of the source with the highest precedence are used
+	require.Empty(t, r.update(sourceStatic, desiredSentries(map[string]sentryConfig{
+		"tcp://a:1234": reconfigured,
+	}, logger)))
+	require.Equal(t, sourceStatic, r.sentries["tcp://a:1234"].source)
+	require.Equal(t, 5*time.Second, r.sentries["tcp://a:1234"].config.dialTimeout)
+	require.Equal(t, 2, signers.startCount("tcp://a:1234"))
+
+	// a sentry is kept while any of its sources discovers it
+	require.Empty(t, r.update(sourceFile, nil))
+	require.Equal(t, []string{"tcp://a:1234", "tcp://b:1234"}, signers.addresses())
+	require.Equal(t, 1, signers.startCount("tcp://b:1234"))
+	require.Equal(t, []string{sourceDNS}, r.sentries["tcp://b:1234"].sources)
+
+	// the settings of the remaining source are used once the other is gone
+	require.Empty(t, r.update(sourceStatic, nil))
+	require.Equal(t, sourceDNS, r.sentries["tcp://a:1234"].source)
+	require.Equal(t, 3, signers.startCount("tcp://a:1234"))
+
+	require.NoError(t, r.stop())
+	require.Empty(t, signers.addresses())
+}
+
+func TestSentryReconcilerRetry(t *testing.T) {
+	signers := newFakeSigners()
+	r := newTestReconciler(t, signers)
+	sentries := desiredSentries(map[string]sentryConfig{
+		"tcp://a:1234": defaultSentryConfig(1024),
+		"tcp://b:1234": defaultSentryConfig(1024),
+	}, cometlog.NewNopLogger())
+
+	signers.setFailing("tcp://b:1234", true)
+	errs := r.update(sourceFile, sentries)
+	require.Len(t, errs, 1)
+	require.ErrorContains(t, errs["tcp://b:1234"], "failed to start remote signer")
+	require.Equal(t, []string{"tcp://a:1234"}, signers.addresses())
+	require.Equal(t, 1, r.count(sourceFile))
+
+	// sentries that failed to start are retried on the next update
+	signers.setFailing("tcp://b:1234", false)
+	require.Empty(t, r.update(sourceFile, sentries))
+	require.Equal(t, []string{"tcp://a:1234", "tcp://b:1234"}, signers.addresses())
+	require.Equal(t, 1, signers.startCount("tcp://a:1234"))
+}
+
+func TestSentryReconcilerRetryInterval(t *testing.T) {
+	signers := newFakeSigners()
+	r := newSentryReconciler(nil, cometlog.NewNopLogger(), signers.factory, sourceStatic)
+	r.retryInterval = 10 * time.Millisecond
+	r.start()
+	t.Cleanup(func() { _ = r.stop() })
+
+	signers.setFailing("tcp://a:1234", true)
+	errs := r.update(sourceStatic, desiredSentries(map[string]sentryConfig{
+		"tcp://a:1234": defaultSentryConfig(1024),
+	}, cometlog.NewNopLogger()))
+	require.ErrorContains(t, errs["tcp://a:1234"], "failed to start remote signer")
+	require.Empty(t, signers.addresses())
+
+	// retried without another update, until it starts
+	time.Sleep(50 * time.Millisecond)
+	require.Empty(t, signers.addresses())
+	signers.setFailing("tcp://a:1234", false)
+	require.Eventually(t, func() bool {
+		return equalStrings([]string{"tcp://a:1234"}, signers.addresses())
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, 1, signers.startCount("tcp://a:1234"))
+}
+
+func TestSentryReconcilerNotStarted(t *testing.T) {
+	signers := newFakeSigners()
+	r := newSentryReconciler(nil, cometlog.NewNopLogger(), signers.factory, sourceStatic)
+
+	require.Empty(t, r.update(sourceStatic, desiredSentries(map[string]sentryConfig{
+		"tcp://a:1234": defaultSentryConfig(1024),
+	}, cometlog.NewNopLogger())))
+	require.Empty(t, signers.addresses(), "sentries are started by start")
+
+	r.start()
+	require.Equal(t, []string{"tcp://a:1234"}, signers.addresses())
+
+	require.NoError(t, r.stop())
+	require.Empty(t, signers.addresses())
+}
+
+func TestSentryReconcilerPause(t *testing.T) {
+	signers := newFakeSigners()
+	r := newTestReconciler(t, signers)
+	logger := cometlog.NewNopLogger()
+	sentries := func(addresses ...string) map[string]desiredSentry {
+		configs := make(map[string]sentryConfig, len(addresses))
+		for _, address := range addresses {
+			configs[address] = defaultSentryConfig(1024)
+		}
+		return desiredSentries(configs, logger)
+	}
+
+	require.Empty(t, r.update(sourceDNS, sentries("tcp://a:1234")))
+	r.pause()
+
+	// discovered sentries are held, static sentries are applied
+	require.Empty(t, r.update(sourceDNS, sentries("tcp://b:1234")))
+	require.Empty(t, r.update(sourceStatic, sentries("tcp://c:1234")))
+	require.Equal(t, []string{"tcp://a:1234", "tcp://c:1234"}, signers.addresses())
+
+	require.Empty(t, r.resume())
+	require.Equal(t, []string{"tcp://b:1234", "tcp://c:1234"}, signers.addresses())
+}
+
+func TestSentryReconcilerDrain(t *testing.T) {
+	signers := newFakeSigners()
+	r := newTestReconciler(t, signers)
+	sentries := desiredSentries(map[string]sentryConfig{"tcp://a:1234": defaultSentryConfig(1024)}, cometlog.NewNopLogger())
+	require.Empty(t, r.update(sourceFile, sentries))
+
+	_, err := r.drain("tcp://b:1234")
+	require.ErrorIs(t, err, errUnknownSentry)
+
+	errs, err := r.drain("tcp://a:1234")
+	require.NoError(t, err)
+	require.Empty(t, errs)
+	require.Empty(t, signers.addresses())
+	require.Equal(t, SentryDrained, r.status()[0].State)
+
+	// drained sentries stay disconnected when they are rediscovered
+	require.Empty(t, r.update(sourceFile, sentries))
+	require.Empty(t, signers.addresses())
+
+	errs, err = r.undrain("tcp://a:1234")
+	require.NoError(t, err)
+	require.Empty(t, errs)
+	require.Equal(t, []string{"tcp://a:1234"}, signers.addresses())
+	require.Equal(t, SentryConnecting, r.status()[0].State)
+
+	_, err = r.undrain("tcp://a:1234")
+	require.ErrorIs(t, err, errUnknownSentry)
+}
+
+func TestSentryReconcilerRemovalGrace(t *testing.T) {
+	signers := newFakeSigners()
+	r := newTestReconciler(t, signers)
+	r.removalGrace = time.Minute
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	sentries := func(addresses ...string) map[string]desiredSentry {
+		configs := make(map[string]sentryConfig, len(addresses))
+		for _, address := range addresses {
+			configs[address] = defaultSentryConfig(1024)
+		}
+		return desiredSentries(configs, cometlog.NewNopLogger())
+	}
+
+	require.Empty(t, r.update(sourceDNS, sentries("tcp://a:1234", "tcp://b:1234")))
+	require.Empty(t, r.update(sourceStatic, sentries("tcp://c:1234")))
+
+	// b stays connected within the grace
+	require.Empty(t, r.update(sourceDNS, sentries("tcp://a:1234")))
+	require.Equal(t, []string{"tcp://a:1234", "tcp://b:1234", "tcp://c:1234"}, signers.addresses())
+	status := r.status()
+	require.Equal(t, "tcp://b:1234", status[1].Address)
+	require.Equal(t, now.Add(time.Minute), *status[1].RemoveAt)
+
+	// and its removal is cancelled when it reappears
+	now = now.Add(30 * time.Second)
+	require.Empty(t, r.update(sourceDNS, sentries("tcp://a:1234", "tcp://b:1234")))
+	require.Nil(t, r.status()[1].RemoveAt)
+	require.Equal(t, 1, signers.startCount("tcp://b:1234"))
+
+	// it is removed once it is still missing after the grace
+	require.Empty(t, r.update(sourceDNS, sentries("tcp://a:1234")))
+	now = now.Add(time.Minute)
+	require.Empty(t, r.update(sourceDNS, sentries("tcp://a:1234")))
+	require.Equal(t, []string{"tcp://a:1234", "tcp://c:1234"}, signers.addresses())
+
+	// sentries removed from the config are removed right away
+	require.Empty(t, r.update(sourceStatic, nil))
+	require.Equal(t, []string{"tcp://a:1234"}, signers.addresses())
+}
+
+func TestSentryReconcilerRemovalGraceTimer(t *testing.T) {
+	signers := newFakeSigners()
+	r := newTestReconciler(t, signers)
+	r.removalGrace = 50 * time.Millisecond
+	sentries := desiredSentries(map[string]sentryConfig{"tcp://a:1234": defaultSentryConfig(1024)}, cometlog.NewNopLogger())
+
+	require.Empty(t, r.update(sourceFile, sentries))
+	require.Empty(t, r.update(sourceFile, nil))
+	require.Equal(t, []string{"tcp://a:1234"}, signers.addresses())
+
+	// removed without another update once the grace has passed
+	require.Eventually(t, func() bool {
+		return len(signers.addresses()) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+)
+
+// configPollInterval is how often the config file is checked for changes.
+const configPollInterval = 5 * time.Second
+
+// configReloader reloads the config file on SIGHUP and when the file changes,
+// and applies the settings that can change at runtime: the log level and the
+// static sentries. An invalid config is rejected as a whole and the current
+// settings are kept. Other settings only take effect after a restart.
+type configReloader struct {
+	source  configSource
+	levels  *levelLogger
+	watcher *SentryWatcher
+	log     cometlog.Logger
+
+	mu      sync.Mutex
+	current Config
+	hash    [sha256.Size]byte
+}
+
+// newConfigReloader returns a configReloader of the config loaded at startup.
+func newConfigReloader(
+	source configSource,
+	current Config,
+	levels *levelLogger,
+	watcher *SentryWatcher,
+	logger cometlog.Logger,
+) *configReloader {
+	r := &configReloader{
+		source:  source,
+		levels:  levels,
+		watcher: watcher,
+		log:     logger,
+		current: current,
+	}
+	r.hash, _ = r.fileHash()
+	return r
+}
+
+func (r *configReloader) fileHash() ([sha256.Size]byte, error) {
+	bz, err := os.ReadFile(r.source.path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(bz), nil
+}
+
+// reload reloads the config file and applies it.
+func (r *configReloader) reload() error {
+	if r.source.path == "" {
+		return fmt.Errorf("no config file to reload, see --%s", flagConfig)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Remember the content even if it is invalid, so it is not reloaded again
+	// until it changes.
+	if hash, err := r.fileHash(); err == nil {
+		r.hash = hash
+	}
+
+	c, err := r.source.load()
+	if err != nil {
+		return err
+	}
+
+	// Validate everything before applying anything, so that a rejected config
+	// leaves all the current settings in place.
+	level := r.source.level(c)
+	if _, err := parseLogLevel(level); err != nil {
+		return fmt.Errorf("invalid log level: %w", err)
+	}
+
+	sentries := r.source.staticSentries(c)
+	configs, err := r.watcher.staticSentryConfigs(sentries)
+	if err != nil {
+		return fmt.Errorf("invalid static sentries: %w", err)
+	}
+
+	// The config is valid, from here on it is applied as a whole.
+	if err := r.levels.SetLevel(level); err != nil {
+		return err
+	}
+
+	if flags := r.source.restartRequired(r.current, c); len(flags) > 0 {
+		r.log.Info("Config changes require a restart to take effect", "flags", flags)
+	}
+	r.current = c
+
+	if err := r.watcher.setStaticSentryConfigs(configs); err != nil {
+		// The other settings are applied, and the sentries that failed to
+		// connect are retried by the reconciler.
+		r.log.Error("Reloaded config, but some static sentries failed to connect",
+			"path", r.source.path, "log_level", level, "static_sentries", len(sentries), "error", err)
+		return nil
+	}
+
+	r.log.Info("Reloaded config", "path", r.source.path, "log_level", level, "static_sentries", len(sentries))
+	return nil
+}
+
+// reloadOrLog reloads the config file and logs if it was rejected.
+func (r *configReloader) reloadOrLog() {
+	if err := r.reload(); err != nil {
+		r.log.Error("Failed to reload config, keeping the current config", "error", err)
+	}
+}
+
+// watch reloads the config file whenever its content changes, until stop is
+// closed. Polling the content, rather than watching for file system events,
+// also catches kubernetes ConfigMap updates, which swap the file's symlink.
+func (r *configReloader) watch(stop <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		hash, err := r.fileHash()
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				r.log.Error("Failed to read config", "path", r.source.path, "error", err)
+			}
+			continue
+		}
+
+		r.mu.Lock()
+		changed := hash != r.hash
+		r.mu.Unlock()
+
+		if changed {
+			r.reloadOrLog()
+		}
+	}
+}
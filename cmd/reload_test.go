@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestReloader returns a configReloader of the start flags and a watcher of
+// the static sentries only, started with fake signers.
+func newTestReloader(t *testing.T, args ...string) (*configReloader, *levelLogger, *fakeSigners) {
+	cmd := startCmd()
+	require.NoError(t, cmd.ParseFlags(args))
+	source, c, err := applyConfig(cmd.Flags())
+	require.NoError(t, err)
+
+	logLevel, _ := cmd.Flags().GetString(flagLogLevel)
+	levels, err := newLevelLogger(cometlog.NewNopLogger(), logLevel)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	signers := newFakeSigners()
+	w, err := NewSentryWatcher(ctx, nil, levels, false, nil, false, KubeOptions{}, source.staticSentries(c), 1024,
+		SentryWatcherSignerFactory(signers.factory))
+	require.NoError(t, err)
+	go w.Watch(ctx, 1024)
+	t.Cleanup(func() {
+		require.NoError(t, w.Stop())
+	})
+
+	return newConfigReloader(source, c, levels, w, levels), levels, signers
+}
+
+func TestConfigReloader(t *testing.T) {
+	path := writeConfig(t, "config.yaml", `
+version: 1
+log:
+  level: info
+sentries:
+  - address: tcp://a:1234
+  - address: tcp://b:1234
+`)
+	r, levels, signers := newTestReloader(t, "--config", path)
+	require.Eventually(t, func() bool {
+		return equalStrings([]string{"tcp://a:1234", "tcp://b:1234"}, signers.addresses())
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, logLevelInfo, levels.level.Load())
+
+	require.NoError(t, os.WriteFile(path, []byte(`
+version: 1
+log:
+  level: debug
+sentries:
+  - address: tcp://b:1234
+  - address: tcp://c:1234
+discovery:
+  mode: crd
+`), 0600))
+	require.NoError(t, r.reload())
+	require.Equal(t, []string{"tcp://b:1234", "tcp://c:1234"}, signers.addresses())
+	require.Equal(t, 1, signers.startCount("tcp://b:1234"), "unchanged sentries keep their connection")
+	require.Equal(t, logLevelDebug, levels.level.Load())
+
+	// an invalid config is rejected and the current state is kept
+	require.NoError(t, os.WriteFile(path, []byte("version: 1\nsentries:\n  - address: tcp://d:1234\n    nodeID: abc\n"), 0600))
+	require.Error(t, r.reload())
+	require.Equal(t, []string{"tcp://b:1234", "tcp://c:1234"}, signers.addresses())
+	require.Equal(t, logLevelDebug, levels.level.Load())
+
+	// changes of the file are picked up without SIGHUP
+	stop := make(chan struct{})
+	defer close(stop)
+	go r.watch(stop, 10*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(path, []byte("version: 1\nsentries:\n  - address: tcp://d:1234\n"), 0600))
+	require.Eventually(t, func() bool {
+		return equalStrings([]string{"tcp://d:1234"}, signers.addresses())
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, logLevelInfo, levels.level.Load(), "the default level applies when the config has none")
+}
+
+func TestConfigReloaderFailingSentry(t *testing.T) {
+	path := writeConfig(t, "config.yaml", "version: 1\nsentries:\n  - address: tcp://a:1234\n")
+	r, levels, signers := newTestReloader(t, "--config", path)
+	require.Eventually(t, func() bool {
+		return equalStrings([]string{"tcp://a:1234"}, signers.addresses())
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// A sentry that fails to connect does not roll back the rest of the config.
+	signers.setFailing("tcp://b:1234", true)
+	require.NoError(t, os.WriteFile(path, []byte(`
+version: 1
+log:
+  level: error
+sentries:
+  - address: tcp://b:1234
+  - address: tcp://c:1234
+`), 0600))
+	require.NoError(t, r.reload())
+	require.Equal(t, []string{"tcp://c:1234"}, signers.addresses())
+	require.Equal(t, logLevelError, levels.level.Load())
+	require.Equal(t, "error", r.current.Log.Level)
+}
+
+func TestConfigReloaderOverrides(t *testing.T) {
+	path := writeConfig(t, "config.yaml", "version: 1\nsentries:\n  - address: tcp://a:1234\n")
+	r, levels, signers := newTestReloader(t, "--config", path, "--log-level", "error", "--sentry", "tcp://flag:1234")
+	require.Eventually(t, func() bool {
+		return equalStrings([]string{"tcp://flag:1234"}, signers.addresses())
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(path, []byte("version: 1\nlog:\n  level: debug\nsentries:\n  - address: tcp://b:1234\n"), 0600))
+	require.NoError(t, r.reload())
+	require.Equal(t, []string{"tcp://flag:1234"}, signers.addresses())
+	require.Equal(t, logLevelError, levels.level.Load())
+}
+
+func TestConfigSourceRestartRequired(t *testing.T) {
+	s := configSource{overrides: map[string]bool{flagNamespace: true}}
+	old := Config{Version: 1, Discovery: DiscoveryConfig{Mode: DiscoveryLabels, Namespaces: []string{"a"}}}
+	c := Config{
+		Version:   1,
+		Log:       LogConfig{Level: "debug"},
+		Horcrux:   HorcruxConfig{GRPC: "horcrux:7070"},
+		Discovery: DiscoveryConfig{AllNamespaces: true},
+	}
+	require.Equal(t, []string{flagDiscovery, flagGRPCAddress}, s.restartRequired(old, c))
+	require.Empty(t, s.restartRequired(c, c))
+}
+
+func TestConfigReloaderWithoutConfig(t *testing.T) {
+	r, _, _ := newTestReloader(t)
+	require.ErrorContains(t, r.reload(), "no config file")
+}
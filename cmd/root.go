@@ -13,6 +13,8 @@ func rootCmd() *cobra.Command {
 	}
 
 	cmd.AddCommand(startCmd())
+	cmd.AddCommand(rbacCmd())
+	cmd.AddCommand(configCmd())
 	cmd.AddCommand(versionCmd())
 
 	return cmd
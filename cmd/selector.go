@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// SelectorOptions configure which sentry Services are discovered by label.
+type SelectorOptions struct {
+	// Groups are independent selectors that are ORed together. The --label
+	// selectors form a group of their own.
+	Groups []string
+
+	// Excludes are selectors of Services that are never discovered, even if
+	// they match a group.
+	Excludes []string
+
+	// NoDefault drops the built-in cosmos-operator sentry label from the groups.
+	NoDefault bool
+}
+
+// sentrySelector matches the labels of sentry Services. A Service matches if
+// it matches any of the groups and none of the excludes.
+type sentrySelector struct {
+	groups   []labels.Selector
+	excludes []labels.Selector
+}
+
+// newSentrySelector returns the selector of the labels, ANDed into one group,
+// and the options. Every selector is validated with labels.Parse. Unless
+// opts.NoDefault is set, the built-in cosmos-operator sentry label is ANDed
+// into every group.
+func newSentrySelector(labelSelectors []string, opts SelectorOptions) (sentrySelector, error) {
+	var groups []string
+	if len(labelSelectors) > 0 || len(opts.Groups) == 0 {
+		groups = append(groups, strings.Join(labelSelectors, ","))
+	}
+	groups = append(groups, opts.Groups...)
+
+	var s sentrySelector
+	for _, group := range groups {
+		terms := []string{group}
+		if !opts.NoDefault {
+			terms = append(terms, labelCosmosSentry)
+		}
+		selector, err := parseSelector(terms...)
+		if err != nil {
+			return sentrySelector{}, err
+		}
+		s.groups = append(s.groups, selector)
+	}
+
+	for _, exclude := range opts.Excludes {
+		selector, err := parseSelector(exclude)
+		if err != nil {
+			return sentrySelector{}, err
+		}
+		if selector.Empty() {
+			return sentrySelector{}, fmt.Errorf("exclude label selector %q would exclude every sentry", exclude)
+		}
+		s.excludes = append(s.excludes, selector)
+	}
+
+	return s, nil
+}
+
+// parseSelector parses the selector terms ANDed together, dropping duplicates
+// and empty terms.
+func parseSelector(terms ...string) (labels.Selector, error) {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, term := range terms {
+		term = strings.TrimSpace(term)
+		if term == "" || seen[term] {
+			continue
+		}
+		seen[term] = true
+		unique = append(unique, term)
+	}
+
+	selector := strings.Join(unique, ",")
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label selector %q: %w", selector, err)
+	}
+	return parsed, nil
+}
+
+// Matches reports whether a sentry Service with the labels is discovered.
+func (s sentrySelector) Matches(set labels.Labels) bool {
+	for _, exclude := range s.excludes {
+		if exclude.Matches(set) {
+			return false
+		}
+	}
+	for _, group := range s.groups {
+		if group.Matches(set) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the selector for logs, e.g. "(a=b) OR (c=d) NOT (e=f)".
+func (s sentrySelector) String() string {
+	groups := make([]string, len(s.groups))
+	for i, group := range s.groups {
+		groups[i] = "(" + group.String() + ")"
+	}
+	str := strings.Join(groups, " OR ")
+	for _, exclude := range s.excludes {
+		str += " NOT (" + exclude.String() + ")"
+	}
+	return str
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestSentrySelector(t *testing.T) {
+	sentry := map[string]string{"app.kubernetes.io/component": "cosmos-sentry"}
+	with := func(extra map[string]string) labels.Set {
+		set := labels.Set{}
+		for k, v := range sentry {
+			set[k] = v
+		}
+		for k, v := range extra {
+			set[k] = v
+		}
+		return set
+	}
+
+	tests := []struct {
+		name     string
+		labels   []string
+		opts     SelectorOptions
+		match    []labels.Set
+		mismatch []labels.Set
+		wantErr  bool
+	}{
+		{
+			name:     "default",
+			match:    []labels.Set{with(nil)},
+			mismatch: []labels.Set{{"team": "a"}},
+		},
+		{
+			name:     "labels are ANDed",
+			labels:   []string{"team=a", "tier in (val,rpc)"},
+			match:    []labels.Set{with(map[string]string{"team": "a", "tier": "val"})},
+			mismatch: []labels.Set{with(map[string]string{"team": "a"}), {"team": "a", "tier": "val"}},
+		},
+		{
+			name:   "groups are ORed",
+			labels: []string{"team=a"},
+			opts:   SelectorOptions{Groups: []string{"team=b", "region=east,tier=val"}},
+			match: []labels.Set{
+				with(map[string]string{"team": "a"}),
+				with(map[string]string{"team": "b"}),
+				with(map[string]string{"region": "east", "tier": "val"}),
+			},
+			mismatch: []labels.Set{
+				with(map[string]string{"team": "c"}),
+				with(map[string]string{"region": "east"}),
+			},
+		},
+		{
+			name:     "groups only",
+			opts:     SelectorOptions{Groups: []string{"team=b"}},
+			match:    []labels.Set{with(map[string]string{"team": "b"})},
+			mismatch: []labels.Set{with(nil)},
+		},
+		{
+			name: "excludes",
+			opts: SelectorOptions{Groups: []string{"team=a", "team=b"}, Excludes: []string{"maintenance=true"}},
+			match: []labels.Set{
+				with(map[string]string{"team": "a", "maintenance": "false"}),
+			},
+			mismatch: []labels.Set{
+				with(map[string]string{"team": "a", "maintenance": "true"}),
+				with(map[string]string{"team": "b", "maintenance": "true"}),
+			},
+		},
+		{
+			name:     "no default",
+			labels:   []string{"app=sentry"},
+			opts:     SelectorOptions{NoDefault: true},
+			match:    []labels.Set{{"app": "sentry"}},
+			mismatch: []labels.Set{with(nil)},
+		},
+		{name: "invalid label", labels: []string{"team in (a"}, wantErr: true},
+		{name: "invalid group", opts: SelectorOptions{Groups: []string{"tier in val"}}, wantErr: true},
+		{name: "invalid exclude", opts: SelectorOptions{Excludes: []string{"!"}}, wantErr: true},
+		{name: "empty exclude", opts: SelectorOptions{Excludes: []string{" "}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newSentrySelector(tt.labels, tt.opts)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			for _, set := range tt.match {
+				require.True(t, s.Matches(set), "%s should match %v", s, set)
+			}
+			for _, set := range tt.mismatch {
+				require.False(t, s.Matches(set), "%s should not match %v", s, set)
+			}
+		})
+	}
+}
+
+func TestSentrySelectorString(t *testing.T) {
+	s, err := newSentrySelector([]string{"team=a"}, SelectorOptions{
+		Groups:   []string{"team=b"},
+		Excludes: []string{"maintenance=true"},
+	})
+	require.NoError(t, err)
+	require.Equal(t,
+		"(app.kubernetes.io/component=cosmos-sentry,team=a) OR "+
+			"(app.kubernetes.io/component=cosmos-sentry,team=b) NOT (maintenance=true)",
+		s.String())
+}
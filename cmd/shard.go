@@ -0,0 +1,348 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	coordinationlisters "k8s.io/client-go/listers/coordination/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// labelShardGroup labels the Leases of the proxy replicas that share sentries.
+	labelShardGroup = "horcrux-proxy.strange.love/shard-group"
+
+	// DefaultShardLeaseDuration is how long a replica owns its sentries after
+	// it last renewed its Lease.
+	DefaultShardLeaseDuration = 15 * time.Second
+)
+
+// errShardLeaseLapsed is returned by owners when this replica's own Lease is not
+// live, in which case it must not connect to any sentry.
+var errShardLeaseLapsed = errors.New("shard lease of this replica is not live")
+
+// ShardOptions configure sharding of sentries across proxy replicas.
+type ShardOptions struct {
+	// Group is the name of the group of replicas that share the sentries.
+	// Sharding is disabled if empty.
+	Group string
+
+	// Identity is the unique name of this replica in the group.
+	Identity string
+
+	// Namespace of the Leases. Defaults to the namespace of this pod.
+	Namespace string
+
+	// LeaseDuration is how long the sentries of a replica stay assigned to it
+	// after it last renewed its Lease. Defaults to DefaultShardLeaseDuration.
+	LeaseDuration time.Duration
+}
+
+// shardCoordinator splits sentries across the live replicas of a group. Every
+// replica holds a Lease that it renews at a third of the lease duration. The
+// replicas with a live Lease are the peers, and each sentry is owned by exactly
+// one of them by rendezvous (highest random weight) hashing, so only the
+// sentries of a lapsed replica move when it goes away.
+//
+// Like client-go leader election, the Leases of other replicas are timed by
+// when this replica observed their renew time change, not by the renew time
+// itself, so clock skew between the replicas does not make a replica take
+// over the sentries of another that still considers itself live.
+type shardCoordinator struct {
+	client        kubernetes.Interface
+	namespace     string
+	group         string
+	identity      string
+	leaseDuration time.Duration
+	log           cometlog.Logger
+	now           func() time.Time
+	onChange      func()
+
+	factory     informers.SharedInformerFactory
+	leaseLister coordinationlisters.LeaseLister
+
+	mu       sync.Mutex
+	peers    []string
+	renewed  time.Time
+	observed map[string]observedLease
+}
+
+// observedLease is the renew time of the Lease of another replica, and the
+// local time when this replica first observed it.
+type observedLease struct {
+	renewTime time.Time
+	at        time.Time
+}
+
+// newShardCoordinator returns a shardCoordinator that calls onChange whenever
+// the live peers change.
+func newShardCoordinator(
+	client kubernetes.Interface,
+	opts ShardOptions,
+	logger cometlog.Logger,
+	onChange func(),
+) (*shardCoordinator, error) {
+	if opts.Identity == "" {
+		return nil, errors.New("shard identity is required")
+	}
+	if opts.LeaseDuration <= 0 {
+		opts.LeaseDuration = DefaultShardLeaseDuration
+	}
+
+	selector := labels.SelectorFromSet(labels.Set{labelShardGroup: opts.Group}).String()
+	factory := informers.NewSharedInformerFactoryWithOptions(client, resyncInterval,
+		informers.WithNamespace(opts.Namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) { o.LabelSelector = selector }),
+	)
+	leases := factory.Coordination().V1().Leases()
+
+	c := &shardCoordinator{
+		client:        client,
+		namespace:     opts.Namespace,
+		group:         opts.Group,
+		identity:      opts.Identity,
+		leaseDuration: opts.LeaseDuration,
+		log:           logger,
+		now:           time.Now,
+		onChange:      onChange,
+		observed:      make(map[string]observedLease),
+		factory:       factory,
+		leaseLister:   leases.Lister(),
+	}
+
+	if _, err := leases.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(any) { c.checkPeers() },
+		UpdateFunc: func(any, any) { c.checkPeers() },
+		DeleteFunc: func(any) { c.checkPeers() },
+	}); err != nil {
+		return nil, fmt.Errorf("failed to add lease event handler: %w", err)
+	}
+
+	return c, nil
+}
+
+// leaseName returns the name of the Lease of this replica.
+func (c *shardCoordinator) leaseName() string {
+	return "horcrux-proxy-" + c.group + "-" + c.identity
+}
+
+// start starts the Lease informer and acquires the Lease of this replica.
+func (c *shardCoordinator) start(ctx context.Context, stop <-chan struct{}) {
+	c.factory.Start(stop)
+	c.factory.WaitForCacheSync(stop)
+	c.renewAndCheck(ctx)
+}
+
+// run renews the Lease of this replica until stop is closed, then releases it
+// so that the other replicas take over its sentries right away. The live peers
+// are checked on every renewal, so a lapsed Lease is noticed without an event.
+func (c *shardCoordinator) run(ctx context.Context, stop <-chan struct{}) {
+	ticker := time.NewTicker(c.leaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			c.release()
+			return
+		case <-ctx.Done():
+			c.release()
+			return
+		case <-ticker.C:
+			c.renewAndCheck(ctx)
+		}
+	}
+}
+
+func (c *shardCoordinator) renewAndCheck(ctx context.Context) {
+	if err := c.renew(ctx); err != nil {
+		c.log.Error("Failed to renew shard lease", "lease", c.leaseName(), "error", err)
+	}
+	c.checkPeers()
+}
+
+// renew creates or renews the Lease of this replica.
+func (c *shardCoordinator) renew(ctx context.Context) error {
+	renewed := c.now()
+	if err := c.writeLease(ctx, renewed); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.renewed = renewed
+	c.mu.Unlock()
+	return nil
+}
+
+// writeLease creates or updates the Lease of this replica with the renew time.
+func (c *shardCoordinator) writeLease(ctx context.Context, renewed time.Time) error {
+	leases := c.client.CoordinationV1().Leases(c.namespace)
+	now := metav1.NewMicroTime(renewed)
+	duration := int32(c.leaseDuration / time.Second)
+
+	lease, err := leases.Get(ctx, c.leaseName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = leases.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      c.leaseName(),
+				Namespace: c.namespace,
+				Labels:    map[string]string{labelShardGroup: c.group},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &c.identity,
+				LeaseDurationSeconds: &duration,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	lease.Spec.HolderIdentity = &c.identity
+	lease.Spec.LeaseDurationSeconds = &duration
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+// release deletes the Lease of this replica.
+func (c *shardCoordinator) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := c.client.CoordinationV1().Leases(c.namespace).Delete(ctx, c.leaseName(), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		c.log.Error("Failed to release shard lease", "lease", c.leaseName(), "error", err)
+	}
+}
+
+// livePeers returns the sorted identities of the replicas with a live Lease.
+// This replica is live if it renewed its Lease within the lease duration,
+// which does not depend on the informer cache having caught up. Other replicas
+// are live if their renew time changed within their lease duration, as
+// observed by the local clock.
+func (c *shardCoordinator) livePeers() ([]string, error) {
+	leases, err := c.leaseLister.Leases(c.namespace).List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shard leases: %w", err)
+	}
+
+	now := c.now()
+	var peers []string
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.renewed.IsZero() && now.Before(c.renewed.Add(c.leaseDuration)) {
+		peers = append(peers, c.identity)
+	}
+
+	seen := make(map[string]bool, len(leases))
+	for _, lease := range leases {
+		spec := lease.Spec
+		if spec.HolderIdentity == nil || spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+			continue
+		}
+		if *spec.HolderIdentity == c.identity {
+			continue
+		}
+
+		key := lease.Name
+		seen[key] = true
+		o, ok := c.observed[key]
+		if !ok || !o.renewTime.Equal(spec.RenewTime.Time) {
+			o = observedLease{renewTime: spec.RenewTime.Time, at: now}
+			c.observed[key] = o
+		}
+
+		expiry := o.at.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second)
+		if now.Before(expiry) {
+			peers = append(peers, *spec.HolderIdentity)
+		}
+	}
+	for key := range c.observed {
+		if !seen[key] {
+			delete(c.observed, key)
+		}
+	}
+	sort.Strings(peers)
+
+	return peers, nil
+}
+
+// checkPeers calls onChange if the live peers changed since the last check.
+func (c *shardCoordinator) checkPeers() {
+	peers, err := c.livePeers()
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	changed := !equalStrings(peers, c.peers)
+	c.peers = peers
+	c.mu.Unlock()
+
+	if changed {
+		c.log.Info("Shard peers changed", "group", c.group, "peers", peers)
+		c.onChange()
+	}
+}
+
+// owners returns a func that reports whether this replica owns a sentry address.
+func (c *shardCoordinator) owners() (func(address string) bool, error) {
+	peers, err := c.livePeers()
+	if err != nil {
+		return nil, err
+	}
+
+	i := sort.SearchStrings(peers, c.identity)
+	if i == len(peers) || peers[i] != c.identity {
+		return nil, errShardLeaseLapsed
+	}
+
+	return func(address string) bool {
+		return shardOwner(peers, address) == c.identity
+	}, nil
+}
+
+// shardOwner returns the peer that owns the sentry address, the one with the
+// highest hash of peer and address.
+func shardOwner(peers []string, address string) string {
+	var owner string
+	var max uint64
+	for _, peer := range peers {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(peer))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(address))
+		if sum := h.Sum64(); owner == "" || sum > max {
+			owner, max = peer, sum
+		}
+	}
+	return owner
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestShardOwner(t *testing.T) {
+	peers := []string{"proxy-0", "proxy-1", "proxy-2"}
+	survivors := []string{"proxy-0", "proxy-2"}
+
+	owned := make(map[string]int)
+	for i := 0; i < 300; i++ {
+		address := fmt.Sprintf("tcp://10.0.%d.%d:1234", i/256, i%256)
+		owner := shardOwner(peers, address)
+		owned[owner]++
+
+		// Only the sentries of the lapsed replica move.
+		if owner != "proxy-1" {
+			require.Equal(t, owner, shardOwner(survivors, address))
+		}
+	}
+
+	for _, peer := range peers {
+		require.Greater(t, owned[peer], 50, peer)
+	}
+}
+
+func TestShardCoordinator(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	newCoordinator := func(identity string) *shardCoordinator {
+		c, err := newShardCoordinator(client, ShardOptions{
+			Group:         "validators",
+			Identity:      identity,
+			Namespace:     "horcrux",
+			LeaseDuration: 15 * time.Second,
+		}, cometlog.NewNopLogger(), func() {})
+		require.NoError(t, err)
+		c.now = clock
+		c.start(ctx, stop)
+		return c
+	}
+
+	a := newCoordinator("proxy-0")
+	b := newCoordinator("proxy-1")
+
+	require.Eventually(t, func() bool {
+		peers, err := a.livePeers()
+		return err == nil && len(peers) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		peers, err := b.livePeers()
+		return err == nil && len(peers) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ownsA, err := a.owners()
+	require.NoError(t, err)
+	ownsB, err := b.owners()
+	require.NoError(t, err)
+
+	addresses := make([]string, 20)
+	for i := range addresses {
+		addresses[i] = fmt.Sprintf("tcp://10.0.0.%d:1234", i)
+		require.NotEqual(t, ownsA(addresses[i]), ownsB(addresses[i]), "exactly one owner of %s", addresses[i])
+	}
+
+	// proxy-1 stops renewing its lease, proxy-0 keeps renewing.
+	now = now.Add(20 * time.Second)
+	require.NoError(t, a.renew(ctx))
+
+	ownsA, err = a.owners()
+	require.NoError(t, err)
+	for _, address := range addresses {
+		require.True(t, ownsA(address))
+	}
+
+	_, err = b.owners()
+	require.ErrorIs(t, err, errShardLeaseLapsed)
+}
+
+func TestShardCoordinatorClockSkew(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+
+	var mu sync.Mutex
+	now := time.Now()
+	clock := func(skew time.Duration) func() time.Time {
+		return func() time.Time {
+			mu.Lock()
+			defer mu.Unlock()
+			return now.Add(skew)
+		}
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+
+	newCoordinator := func(identity string, skew time.Duration) *shardCoordinator {
+		c, err := newShardCoordinator(client, ShardOptions{
+			Group:         "validators",
+			Identity:      identity,
+			Namespace:     "horcrux",
+			LeaseDuration: 15 * time.Second,
+		}, cometlog.NewNopLogger(), func() {})
+		require.NoError(t, err)
+		c.now = clock(skew)
+		c.start(ctx, stop)
+		return c
+	}
+
+	// The clock of proxy-1 is a minute behind, so its renew times look long
+	// expired to proxy-0.
+	a := newCoordinator("proxy-0", 0)
+	b := newCoordinator("proxy-1", -time.Minute)
+
+	livePeers := func(c *shardCoordinator) []string {
+		peers, err := c.livePeers()
+		require.NoError(t, err)
+		return peers
+	}
+	renewed := func(c *shardCoordinator) time.Time {
+		lease, err := c.leaseLister.Leases("horcrux").Get(b.leaseName())
+		if err != nil || lease.Spec.RenewTime == nil {
+			return time.Time{}
+		}
+		return lease.Spec.RenewTime.Time
+	}
+
+	require.Eventually(t, func() bool {
+		return len(livePeers(a)) == 2 && len(livePeers(b)) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// proxy-1 keeps renewing, proxy-0 keeps seeing it live.
+	for i := 0; i < 3; i++ {
+		advance(10 * time.Second)
+		require.NoError(t, a.renew(ctx))
+		require.NoError(t, b.renew(ctx))
+		want := b.now()
+		require.Eventually(t, func() bool {
+			return renewed(a).Equal(want)
+		}, 5*time.Second, 10*time.Millisecond)
+		require.Equal(t, []string{"proxy-0", "proxy-1"}, livePeers(a))
+	}
+
+	// proxy-1 stops renewing, its lease lapses a lease duration after proxy-0
+	// last saw it change.
+	advance(10 * time.Second)
+	require.NoError(t, a.renew(ctx))
+	require.Equal(t, []string{"proxy-0", "proxy-1"}, livePeers(a))
+	advance(10 * time.Second)
+	require.NoError(t, a.renew(ctx))
+	require.Equal(t, []string{"proxy-0"}, livePeers(a))
+}
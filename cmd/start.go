@@ -2,15 +2,26 @@ package cmd
 
 import (
 	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 
 	cometlog "github.com/cometbft/cometbft/libs/log"
-	cometos "github.com/cometbft/cometbft/libs/os"
 	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/strangelove-ventures/horcrux-proxy/privval"
 	"github.com/strangelove-ventures/horcrux-proxy/signer"
 )
 
+const (
+	pathGRPC   = "grpc"
+	pathListen = "listen"
+)
+
 const (
 	flagLogLevel    = "log-level"
 	flagListen      = "listen"
@@ -19,7 +30,55 @@ const (
 	flagOperator    = "operator"
 	flagSentry      = "sentry"
 	flagSentryLabel = "label"
+	flagLabelGroup  = "label-group"
+	flagExclude     = "exclude-label"
+	flagNoDefault   = "no-default-label"
 	flagMaxReadSize = "max-read-size"
+	flagDialTimeout = "dial-timeout"
+	flagConfig      = "config"
+
+	flagKubeconfig     = "kubeconfig"
+	flagKubeContext    = "context"
+	flagNode           = "node"
+	flagTopologyKey    = "topology-key"
+	flagNamespace      = "namespace"
+	flagAllNamespaces  = "all-namespaces"
+	flagDiscovery      = "discovery"
+	flagReadyGrace     = "ready-grace"
+	flagRemovalGrace   = "removal-grace"
+	flagPrimary        = "primary"
+	flagListenMaxConns = "listen-max-conns"
+	flagUnixAllowUID   = "unix-allow-uid"
+	flagUnixAllowGID   = "unix-allow-gid"
+	flagUnixSocketMode = "unix-socket-mode"
+
+	flagCluster        = "cluster"
+	flagClusterContext = "cluster-context"
+	flagClusterLabel   = "cluster-label"
+
+	flagShardGroup         = "shard-group"
+	flagShardIdentity      = "shard-identity"
+	flagShardLeaseDuration = "shard-lease-duration"
+
+	flagDNSSentry   = "dns-sentry"
+	flagDNSSRV      = "dns-srv"
+	flagDNSInterval = "dns-interval"
+	flagDNSServer   = "dns-server"
+
+	flagSentryFile         = "sentry-file"
+	flagSentryFileInterval = "sentry-file-interval"
+
+	flagSentryURL                = "sentry-url"
+	flagSentryURLInterval        = "sentry-url-interval"
+	flagSentryURLAuthHeader      = "sentry-url-auth-header"
+	flagSentryURLAuthFile        = "sentry-url-auth-file"
+	flagSentryURLCA              = "sentry-url-ca"
+	flagSentryURLCert            = "sentry-url-cert"
+	flagSentryURLKey             = "sentry-url-key"
+	flagSentryURLInsecureSkipTLS = "sentry-url-insecure-skip-verify"
+
+	flagAdminAddress   = "admin-address"
+	flagAdminTokenFile = "admin-token-file"
 )
 
 func startCmd() *cobra.Command {
@@ -31,85 +90,354 @@ func startCmd() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			out := cmd.OutOrStdout()
 
+			source, config, err := applyConfig(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
 			logLevel, _ := cmd.Flags().GetString(flagLogLevel)
-			logLevelOpt, err := cometlog.AllowLevel(logLevel)
+			levels, err := newLevelLogger(cometlog.NewTMLogger(cometlog.NewSyncWriter(out)), logLevel)
 			if err != nil {
 				return fmt.Errorf("failed to parse log level: %w", err)
 			}
 
-			logger := cometlog.NewFilter(cometlog.NewTMLogger(cometlog.NewSyncWriter(out)), logLevelOpt).With("module", "validator")
+			logger := levels.With("module", "validator")
 			logger.Info("Horcrux Proxy")
 
 			listenAddrs, _ := cmd.Flags().GetStringArray(flagListen)
 			all, _ := cmd.Flags().GetBool(flagAll)
 
+			listenerOpts, err := signerListenerOptions(cmd)
+			if err != nil {
+				return err
+			}
+
 			listeners := make([]privval.SignerListener, len(listenAddrs))
 			for i, addr := range listenAddrs {
-				listeners[i] = privval.NewSignerListener(logger, addr)
+				listeners[i] = privval.NewSignerListener(logger, addr, listenerOpts...)
 			}
 
-			var hc signer.HorcruxConnection
+			var paths []signer.HorcruxConnectionPath
 
 			grpcAddr, _ := cmd.Flags().GetString(flagGRPCAddress)
 
 			if grpcAddr != "" {
-				hc, err = signer.NewHorcruxGRPCClient(logger, grpcAddr)
+				grpcClient, err := signer.NewHorcruxGRPCClient(logger, grpcAddr)
 				if err != nil {
 					return fmt.Errorf("failed to create grpc connection: %w", err)
 				}
-			} else {
+				paths = append(paths, signer.HorcruxConnectionPath{Name: pathGRPC, Connection: grpcClient})
+			}
+
+			if grpcAddr == "" || len(listeners) > 0 {
 				loadBalancer := privval.NewRemoteSignerLoadBalancer(logger, listeners)
 				if err = loadBalancer.Start(); err != nil {
 					return fmt.Errorf("failed to start listener(s): %w", err)
 				}
 				defer logIfErr(logger, loadBalancer.Stop)
 
-				hc = loadBalancer
+				paths = append(paths, signer.HorcruxConnectionPath{Name: pathListen, Connection: loadBalancer})
+			}
+
+			primary, _ := cmd.Flags().GetString(flagPrimary)
+			hc, err := horcruxConnection(logger, paths, primary)
+			if err != nil {
+				return err
 			}
 
 			ctx := cmd.Context()
 
 			// if we're running in kubernetes, we can auto-discover sentries
 			operator, _ := cmd.Flags().GetBool(flagOperator)
-			sentries, _ := cmd.Flags().GetStringArray(flagSentry)
 			labels, _ := cmd.Flags().GetStringArray(flagSentryLabel)
 			maxReadSize, _ := cmd.Flags().GetInt(flagMaxReadSize)
+			dialTimeout, _ := cmd.Flags().GetDuration(flagDialTimeout)
+			kubeOpts := KubeOptions{}
+			kubeOpts.Kubeconfig, _ = cmd.Flags().GetString(flagKubeconfig)
+			kubeOpts.Context, _ = cmd.Flags().GetString(flagKubeContext)
+			kubeOpts.Node, _ = cmd.Flags().GetString(flagNode)
+			kubeOpts.Namespaces, _ = cmd.Flags().GetStringArray(flagNamespace)
+			kubeOpts.TopologyKeys, _ = cmd.Flags().GetStringArray(flagTopologyKey)
+			kubeOpts.ReadyGrace, _ = cmd.Flags().GetDuration(flagReadyGrace)
+			kubeOpts.Selector.Groups, _ = cmd.Flags().GetStringArray(flagLabelGroup)
+			kubeOpts.Selector.Excludes, _ = cmd.Flags().GetStringArray(flagExclude)
+			kubeOpts.Selector.NoDefault, _ = cmd.Flags().GetBool(flagNoDefault)
+			if allNamespaces, _ := cmd.Flags().GetBool(flagAllNamespaces); allNamespaces {
+				kubeOpts.Namespaces = []string{metav1.NamespaceAll}
+			}
+			kubeOpts.Shard.Group, _ = cmd.Flags().GetString(flagShardGroup)
+			kubeOpts.Shard.Identity, _ = cmd.Flags().GetString(flagShardIdentity)
+			kubeOpts.Shard.LeaseDuration, _ = cmd.Flags().GetDuration(flagShardLeaseDuration)
+			kubeOpts.Clusters, err = clusterOptions(cmd)
+			if err != nil {
+				return err
+			}
+			kubeOpts.Discovery, _ = cmd.Flags().GetString(flagDiscovery)
+			if kubeOpts.Discovery != DiscoveryLabels && kubeOpts.Discovery != DiscoveryCRD {
+				return fmt.Errorf("invalid --%s %q, must be %s or %s", flagDiscovery, kubeOpts.Discovery, DiscoveryLabels, DiscoveryCRD)
+			}
 
-			watcher, err := NewSentryWatcher(ctx, labels, logger, all, hc, operator, sentries, maxReadSize)
+			dnsOpts := DNSOptions{}
+			dnsOpts.Names, _ = cmd.Flags().GetStringArray(flagDNSSentry)
+			dnsOpts.SRV, _ = cmd.Flags().GetStringArray(flagDNSSRV)
+			dnsOpts.Interval, _ = cmd.Flags().GetDuration(flagDNSInterval)
+			dnsOpts.Server, _ = cmd.Flags().GetString(flagDNSServer)
+
+			fileOpts := FileOptions{}
+			fileOpts.Paths, _ = cmd.Flags().GetStringArray(flagSentryFile)
+			fileOpts.Interval, _ = cmd.Flags().GetDuration(flagSentryFileInterval)
+
+			httpOpts := HTTPOptions{}
+			httpOpts.URL, _ = cmd.Flags().GetString(flagSentryURL)
+			httpOpts.Interval, _ = cmd.Flags().GetDuration(flagSentryURLInterval)
+			httpOpts.AuthHeader, _ = cmd.Flags().GetString(flagSentryURLAuthHeader)
+			httpOpts.AuthFile, _ = cmd.Flags().GetString(flagSentryURLAuthFile)
+			httpOpts.CAFile, _ = cmd.Flags().GetString(flagSentryURLCA)
+			httpOpts.CertFile, _ = cmd.Flags().GetString(flagSentryURLCert)
+			httpOpts.KeyFile, _ = cmd.Flags().GetString(flagSentryURLKey)
+			httpOpts.InsecureSkipVerify, _ = cmd.Flags().GetBool(flagSentryURLInsecureSkipTLS)
+
+			removalGrace, _ := cmd.Flags().GetDuration(flagRemovalGrace)
+
+			watcher, err := NewSentryWatcher(ctx, labels, logger, all, hc, operator, kubeOpts, source.staticSentries(config), maxReadSize,
+				SentryWatcherDialTimeout(dialTimeout), SentryWatcherDNS(dnsOpts), SentryWatcherFiles(fileOpts), SentryWatcherHTTP(httpOpts),
+				SentryWatcherRemovalGrace(removalGrace))
 			if err != nil {
 				return err
 			}
 			defer logIfErr(logger, watcher.Stop)
 			go watcher.Watch(ctx, maxReadSize)
 
-			waitForSignals(logger)
+			adminOpts := AdminOptions{}
+			adminOpts.Address, _ = cmd.Flags().GetString(flagAdminAddress)
+			adminOpts.TokenFile, _ = cmd.Flags().GetString(flagAdminTokenFile)
+			if adminOpts.enabled() {
+				admin, err := newAdminServer(adminOpts, watcher, logger)
+				if err != nil {
+					return err
+				}
+				defer logIfErr(logger, admin.stop)
+				go admin.serve()
+			}
+
+			reloader := newConfigReloader(source, config, levels, watcher, logger)
+			if source.path != "" {
+				stop := make(chan struct{})
+				defer close(stop)
+				go reloader.watch(stop, configPollInterval)
+			}
+
+			waitForSignals(logger, reloader.reloadOrLog)
 
 			return nil
 		},
 	}
 
+	cmd.Flags().String(flagConfig, "", "Path of a YAML or TOML config file, overridden by flags and HORCRUX_PROXY_* env vars")
 	cmd.Flags().StringArrayP(flagListen, "l", nil, "Privval listen addresses for the proxy (e.g. tcp://0.0.0.0:1234)")
 	cmd.Flags().StringArrayP(flagSentry, "s", nil, "Privval connect addresses for the proxy")
 	cmd.Flags().StringArrayP(flagSentryLabel, "L", nil, "the label of the sentry to connect to")
+	cmd.Flags().StringArray(flagLabelGroup, nil,
+		"Label selector of another group of sentries to connect to, ORed with the --label selector (e.g. 'team=a,tier in (val)')")
+	cmd.Flags().StringArray(flagExclude, nil, "Label selector of sentry Services never to connect to, even if they match --label or --label-group")
+	cmd.Flags().Bool(flagNoDefault, false, "Don't require the app.kubernetes.io/component=cosmos-sentry label on sentry Services")
 	cmd.Flags().BoolP(flagOperator, "o", true, "Use this when running in kubernetes with the Cosmos Operator to auto-discover sentries")
+	cmd.Flags().String(flagKubeconfig, "", "Path to a kubeconfig to discover sentries from outside of the cluster (default in-cluster config)")
+	cmd.Flags().String(flagKubeContext, "", "Kubeconfig context to use (default current context)")
+	cmd.Flags().String(flagNode, "", "Node to connect to sentries on, required outside of the cluster unless --all is set (default the node of this pod)")
+	cmd.Flags().StringArray(flagTopologyKey, nil,
+		"Node label(s), narrowest first, of topology domains to fall back to when there is no healthy sentry on this node (e.g. topology.kubernetes.io/zone)")
+	cmd.Flags().StringArrayP(flagNamespace, "n", nil, "Namespace(s) to discover sentries in (default the namespace of this pod or kubeconfig context)")
+	cmd.Flags().Bool(flagAllNamespaces, false, "Discover sentries in all namespaces (requires cluster-wide permissions)")
+	cmd.Flags().String(flagDiscovery, DiscoveryLabels,
+		"How to discover sentries: labels (sentry Services by label) or crd (CosmosFullNode resources of type Sentry)")
+	cmd.Flags().Duration(flagReadyGrace, 0, "How long a sentry pod must have been Ready before connecting to it")
+	cmd.Flags().Duration(flagRemovalGrace, 0,
+		"How long a sentry that is no longer discovered stays connected, in case it reappears (default remove right away)")
+	cmd.Flags().StringArray(flagCluster, nil,
+		"Other cluster to discover sentries in, as NAME=KUBECONFIG (e.g. east=/etc/horcrux-proxy/east.yaml)")
+	cmd.Flags().StringArray(flagClusterContext, nil, "Kubeconfig context of another cluster, as NAME=CONTEXT (default current context)")
+	cmd.Flags().StringArray(flagClusterLabel, nil, "Label of the sentries to connect to in another cluster, as NAME=LABEL")
+	cmd.Flags().String(flagShardGroup, "",
+		"Split sentries across the proxy replicas with this shard group, coordinated with Leases (default disabled)")
+	cmd.Flags().String(flagShardIdentity, os.Getenv("HOSTNAME"), "Unique identity of this replica in the shard group (default $HOSTNAME)")
+	cmd.Flags().Duration(flagShardLeaseDuration, DefaultShardLeaseDuration,
+		"How long sentries stay assigned to a replica after it last renewed its shard Lease")
+	cmd.Flags().StringArray(flagDNSSentry, nil,
+		"DNS name of sentries as HOST:PORT, connecting to each A/AAAA record of HOST on PORT (e.g. sentries.example.com:1234)")
+	cmd.Flags().StringArray(flagDNSSRV, nil,
+		"DNS SRV name of sentries, connecting to each address of each target on its port (e.g. _privval._tcp.example.com)")
+	cmd.Flags().Duration(flagDNSInterval, DefaultDNSInterval, "How often the DNS names of sentries are resolved")
+	cmd.Flags().String(flagDNSServer, "", "DNS server to resolve the names of sentries with, as HOST:PORT (default the system resolver)")
+	cmd.Flags().StringArray(flagSentryFile, nil,
+		"YAML or JSON file listing sentries to connect to, in the style of Prometheus file_sd, re-read when it changes (e.g. /etc/horcrux-proxy/sentries/*.yaml)")
+	cmd.Flags().Duration(flagSentryFileInterval, DefaultSentryFileInterval, "How often sentry files are checked for changes")
+	cmd.Flags().String(flagSentryURL, "", "HTTP(S) URL that returns a JSON list of sentries to connect to, e.g. of an inventory service")
+	cmd.Flags().Duration(flagSentryURLInterval, DefaultHTTPInterval, "How often the sentry URL is polled")
+	cmd.Flags().String(flagSentryURLAuthHeader, "Authorization", "Header to send the content of --sentry-url-auth-file in")
+	cmd.Flags().String(flagSentryURLAuthFile, "", "File with the auth header value for the sentry URL (e.g. 'Bearer <token>'), re-read on every poll")
+	cmd.Flags().String(flagSentryURLCA, "", "PEM CA certificate(s) to verify the sentry URL with (default system roots)")
+	cmd.Flags().String(flagSentryURLCert, "", "PEM client certificate for the sentry URL")
+	cmd.Flags().String(flagSentryURLKey, "", "PEM client key for the sentry URL")
+	cmd.Flags().Bool(flagSentryURLInsecureSkipTLS, false, "Don't verify the TLS certificate of the sentry URL")
+	cmd.Flags().String(flagAdminAddress, "",
+		"Address of the admin API, a loopback tcp address or a unix socket (e.g. unix:///run/horcrux-proxy/admin.sock) (default disabled)")
+	cmd.Flags().String(flagAdminTokenFile, "", "File with the bearer token of the admin API, re-read on every request")
 	cmd.Flags().StringP(flagGRPCAddress, "g", "", "GRPC address for the proxy")
 	cmd.Flags().BoolP(flagAll, "a", false, "Connect to sentries on all nodes")
 	cmd.Flags().String(flagLogLevel, "info", "Set log level (debug, info, error, none)")
 	cmd.Flags().Int(flagMaxReadSize, 1024*1024, "Max read size for privval messages")
+	cmd.Flags().Duration(flagDialTimeout, defaultDialTimeout, "Timeout for dialing sentries")
+	cmd.Flags().String(flagPrimary, pathGRPC, "Horcrux connection to try first when both --grpc and --listen are set (grpc, listen)")
+	cmd.Flags().Int(flagListenMaxConns, 1, "Max concurrent cosigner connections accepted on each listen address")
+	cmd.Flags().UintSlice(flagUnixAllowUID, nil, "User IDs allowed to connect to unix socket listen addresses (default any)")
+	cmd.Flags().UintSlice(flagUnixAllowGID, nil, "Group IDs allowed to connect to unix socket listen addresses, matched against the peer's primary group only (default any)")
+	cmd.Flags().String(flagUnixSocketMode, strconv.FormatUint(uint64(privval.DefaultUnixSocketMode), 8),
+		"File mode (octal) of unix socket listen addresses")
 
 	return cmd
 }
 
+// clusterOptions returns the other clusters to discover sentries in, from the
+// --cluster, --cluster-context and --cluster-label flags.
+func clusterOptions(cmd *cobra.Command) ([]ClusterOptions, error) {
+	clusters, _ := cmd.Flags().GetStringArray(flagCluster)
+	contexts, _ := cmd.Flags().GetStringArray(flagClusterContext)
+	labels, _ := cmd.Flags().GetStringArray(flagClusterLabel)
+	return parseClusterOptions(clusters, contexts, labels)
+}
+
+// parseClusterOptions parses NAME=VALUE cluster flag values.
+func parseClusterOptions(clusters, contexts, labels []string) ([]ClusterOptions, error) {
+	opts := make([]ClusterOptions, 0, len(clusters))
+	byName := make(map[string]*ClusterOptions)
+
+	for _, c := range clusters {
+		name, kubeconfig, ok := strings.Cut(c, "=")
+		if !ok || name == "" || kubeconfig == "" {
+			return nil, fmt.Errorf("invalid --%s %q, must be NAME=KUBECONFIG", flagCluster, c)
+		}
+		if _, exists := byName[name]; exists {
+			return nil, fmt.Errorf("duplicate --%s %q", flagCluster, name)
+		}
+		opts = append(opts, ClusterOptions{Name: name, Kubeconfig: kubeconfig})
+		byName[name] = &opts[len(opts)-1]
+	}
+
+	for _, c := range contexts {
+		name, context, ok := strings.Cut(c, "=")
+		cluster, exists := byName[name]
+		if !ok || !exists {
+			return nil, fmt.Errorf("invalid --%s %q, must be NAME=CONTEXT of a --%s", flagClusterContext, c, flagCluster)
+		}
+		cluster.Context = context
+	}
+
+	for _, l := range labels {
+		name, label, ok := strings.Cut(l, "=")
+		cluster, exists := byName[name]
+		if !ok || !exists || label == "" {
+			return nil, fmt.Errorf("invalid --%s %q, must be NAME=LABEL of a --%s", flagClusterLabel, l, flagCluster)
+		}
+		cluster.Labels = append(cluster.Labels, label)
+	}
+
+	return opts, nil
+}
+
+// horcruxConnection returns the connection to horcrux for the given paths. When both
+// the grpc and listener paths are configured, requests are sent over the primary
+// path first and fall back to the other one if horcrux can't be reached.
+func horcruxConnection(
+	logger cometlog.Logger,
+	paths []signer.HorcruxConnectionPath,
+	primary string,
+) (signer.HorcruxConnection, error) {
+	if primary != pathGRPC && primary != pathListen {
+		return nil, fmt.Errorf("invalid %s %q, must be %q or %q", flagPrimary, primary, pathGRPC, pathListen)
+	}
+
+	if len(paths) == 1 {
+		return paths[0].Connection, nil
+	}
+
+	if paths[0].Name != primary {
+		paths[0], paths[1] = paths[1], paths[0]
+	}
+
+	logger.Info("Using horcrux connection with fallback", "primary", paths[0].Name, "fallback", paths[1].Name)
+
+	return signer.NewFallbackHorcruxConnection(logger, paths...), nil
+}
+
+// signerListenerOptions builds the privval listener options from the listener flags.
+func signerListenerOptions(cmd *cobra.Command) ([]privval.SignerListenerOption, error) {
+	uids, _ := cmd.Flags().GetUintSlice(flagUnixAllowUID)
+	gids, _ := cmd.Flags().GetUintSlice(flagUnixAllowGID)
+	modeStr, _ := cmd.Flags().GetString(flagUnixSocketMode)
+	maxConns, _ := cmd.Flags().GetInt(flagListenMaxConns)
+
+	mode, err := strconv.ParseUint(modeStr, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse unix socket mode %q: %w", modeStr, err)
+	}
+
+	allowedUIDs, err := toUint32s(flagUnixAllowUID, uids)
+	if err != nil {
+		return nil, err
+	}
+	allowedGIDs, err := toUint32s(flagUnixAllowGID, gids)
+	if err != nil {
+		return nil, err
+	}
+
+	unixOpts := make([]privval.UnixListenerOption, 0, 2)
+	if len(allowedUIDs) > 0 {
+		unixOpts = append(unixOpts, privval.UnixListenerAllowedUIDs(allowedUIDs...))
+	}
+	if len(allowedGIDs) > 0 {
+		unixOpts = append(unixOpts, privval.UnixListenerAllowedGIDs(allowedGIDs...))
+	}
+
+	return []privval.SignerListenerOption{
+		privval.SignerListenerUnixSocketMode(os.FileMode(mode)),
+		privval.SignerListenerUnixOptions(unixOpts...),
+		privval.SignerListenerEndpointOptions(privval.SignerListenerEndpointMaxConnections(maxConns)),
+	}, nil
+}
+
+// toUint32s converts the IDs of the flag, which must fit in 32 bits like
+// user and group IDs do.
+func toUint32s(flag string, in []uint) ([]uint32, error) {
+	out := make([]uint32, len(in))
+	for i, v := range in {
+		if v > math.MaxUint32 {
+			return nil, fmt.Errorf("invalid --%s %d: out of range", flag, v)
+		}
+		out[i] = uint32(v)
+	}
+	return out, nil
+}
+
 func logIfErr(logger cometlog.Logger, fn func() error) {
 	if err := fn(); err != nil {
 		logger.Error("Error", "err", err)
 	}
 }
 
-func waitForSignals(logger cometlog.Logger) {
-	done := make(chan struct{})
-	cometos.TrapSignal(logger, func() {
-		close(done)
-	})
-	<-done
+// waitForSignals returns on SIGINT or SIGTERM, and calls reload on SIGHUP.
+func waitForSignals(logger cometlog.Logger, reload func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+
+	for sig := range sigs {
+		if sig == syscall.SIGHUP {
+			logger.Info("Captured SIGHUP, reloading config")
+			reload()
+			continue
+		}
+		logger.Info("signal trapped", "msg", fmt.Sprintf("captured %v, exiting...", sig))
+		return
+	}
 }
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignerListenerOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		flag    string
+		value   string
+		wantErr string
+	}{
+		{name: "uid", flag: flagUnixAllowUID, value: "1000,4294967295"},
+		{name: "gid", flag: flagUnixAllowGID, value: "1000,4294967295"},
+		{name: "uid out of range", flag: flagUnixAllowUID, value: "4294967296", wantErr: "invalid --unix-allow-uid 4294967296"},
+		{name: "gid out of range", flag: flagUnixAllowGID, value: "4294967296", wantErr: "invalid --unix-allow-gid 4294967296"},
+		{name: "socket mode", flag: flagUnixSocketMode, value: "660"},
+		{name: "invalid socket mode", flag: flagUnixSocketMode, value: "rw", wantErr: "failed to parse unix socket mode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := startCmd()
+			require.NoError(t, cmd.Flags().Set(tt.flag, tt.value))
+
+			opts, err := signerListenerOptions(cmd)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, opts, 3)
+		})
+	}
+}
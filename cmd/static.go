@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SetStaticSentries replaces the static sentries, e.g. when the config file is
+// reloaded. Only the remote signers of sentries that were added, removed or
+// reconfigured are started or stopped, the connections to the others are kept.
+// If any of the sentries is invalid, none of them are changed.
+func (w *SentryWatcher) SetStaticSentries(sentries []StaticSentry) error {
+	configs, err := w.staticSentryConfigs(sentries)
+	if err != nil {
+		return err
+	}
+	return w.setStaticSentryConfigs(configs)
+}
+
+// staticSentryConfigs validates the static sentries and returns their
+// configs by address.
+func (w *SentryWatcher) staticSentryConfigs(sentries []StaticSentry) (map[string]sentryConfig, error) {
+	defaults := w.defaultSentryConfig(w.maxReadSize)
+	configs := make(map[string]sentryConfig, len(sentries))
+	for _, s := range sentries {
+		if s.Address == "" {
+			return nil, errors.New("static sentry address is required")
+		}
+		if _, exists := configs[s.Address]; exists {
+			return nil, fmt.Errorf("duplicate static sentry %s", s.Address)
+		}
+		config, err := s.config(defaults)
+		if err != nil {
+			return nil, fmt.Errorf("static sentry %s: %w", s.Address, err)
+		}
+		configs[s.Address] = config
+	}
+	return configs, nil
+}
+
+// setStaticSentryConfigs replaces the static sentries with the validated
+// configs. The returned errors are of sentries that failed to connect, the
+// others are applied regardless.
+func (w *SentryWatcher) setStaticSentryConfigs(configs map[string]sentryConfig) error {
+	errs := w.reconciler.update(sourceStatic, desiredSentries(configs, w.log))
+	return ReconcileResult{Errors: errs}.Err()
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSentryWatcherStaticSentries(t *testing.T) {
+	ctx := context.Background()
+	signers := newFakeSigners()
+
+	w, err := NewSentryWatcher(ctx, nil, cometlog.NewNopLogger(), false, nil, false, KubeOptions{}, []StaticSentry{
+		{Address: "tcp://a:1234"},
+		{Address: "tcp://b:1234"},
+	}, 1024, SentryWatcherSignerFactory(signers.factory))
+	require.NoError(t, err)
+	require.Empty(t, signers.addresses(), "static sentries are started by Watch")
+
+	go w.Watch(ctx, 1024)
+	require.Eventually(t, func() bool {
+		return len(signers.addresses()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// a is unchanged, b is reconfigured, c is added
+	require.NoError(t, w.SetStaticSentries([]StaticSentry{
+		{Address: "tcp://a:1234"},
+		{Address: "tcp://b:1234", DialTimeout: Duration(5 * time.Second)},
+		{Address: "tcp://c:1234"},
+	}))
+	require.Equal(t, []string{"tcp://a:1234", "tcp://b:1234", "tcp://c:1234"}, signers.addresses())
+	require.Equal(t, 1, signers.startCount("tcp://a:1234"))
+	require.Equal(t, 2, signers.startCount("tcp://b:1234"))
+	require.Equal(t, 1, signers.startCount("tcp://c:1234"))
+
+	// invalid sentries are rejected as a whole
+	require.Error(t, w.SetStaticSentries([]StaticSentry{{Address: "tcp://a:1234"}, {Address: "tcp://d:1234", NodeID: "abc"}}))
+	require.Error(t, w.SetStaticSentries([]StaticSentry{{Address: "tcp://a:1234"}, {Address: "tcp://a:1234"}}))
+	require.Equal(t, []string{"tcp://a:1234", "tcp://b:1234", "tcp://c:1234"}, signers.addresses())
+
+	// a and b are removed
+	require.NoError(t, w.SetStaticSentries([]StaticSentry{{Address: "tcp://c:1234"}}))
+	require.Equal(t, []string{"tcp://c:1234"}, signers.addresses())
+	require.Equal(t, 1, signers.startCount("tcp://c:1234"))
+
+	require.NoError(t, w.Stop())
+	require.Empty(t, signers.addresses())
+}
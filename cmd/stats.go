@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"sync"
+	"time"
+
+	"github.com/strangelove-ventures/horcrux-proxy/signer"
+)
+
+// SentryState is the state of the connection to a sentry.
+type SentryState string
+
+const (
+	// SentryConnecting is the state of a sentry that has not been connected to yet.
+	SentryConnecting SentryState = "connecting"
+
+	// SentryConnected is the state of a sentry with an established connection.
+	SentryConnected SentryState = "connected"
+
+	// SentryDisconnected is the state of a sentry whose connection was lost,
+	// while it is redialed.
+	SentryDisconnected SentryState = "disconnected"
+
+	// SentryHandshakeFailed is the state of a sentry whose last secret
+	// connection handshake or node ID verification failed.
+	SentryHandshakeFailed SentryState = "handshake_failed"
+
+	// SentryDrained is the state of a sentry that is disconnected through the
+	// admin API until it is undrained.
+	SentryDrained SentryState = "drained"
+
+	// SentryFailed is the state of a sentry whose remote signer failed to
+	// start. It is retried on the next update of its sources.
+	SentryFailed SentryState = "failed"
+)
+
+// SentryStatus is the status of a sentry, as listed by the admin API.
+type SentryStatus struct {
+	// Address of the sentry, prefixed by "cluster/" for sentries of other
+	// clusters.
+	Address string `json:"address"`
+
+	// Source is the source whose settings are used, Sources are all the
+	// sources that discovered the sentry.
+	Source  string   `json:"source"`
+	Sources []string `json:"sources"`
+
+	ChainIDs []string    `json:"chainIDs,omitempty"`
+	State    SentryState `json:"state"`
+	Stats    SentryStats `json:"stats"`
+
+	// RemoveAt is when the sentry is removed, if it is no longer discovered
+	// but still within the removal grace.
+	RemoveAt *time.Time `json:"removeAt,omitempty"`
+}
+
+// SentryStats are the connection statistics of a sentry, since its remote
+// signer was last started.
+type SentryStats struct {
+	Started        time.Time  `json:"started"`
+	ConnectedSince *time.Time `json:"connectedSince,omitempty"`
+
+	Connects          int `json:"connects"`
+	Disconnects       int `json:"disconnects"`
+	HandshakeFailures int `json:"handshakeFailures"`
+
+	// RequestsFailing is how many times several consecutive signing requests
+	// from the sentry failed.
+	RequestsFailing int `json:"requestsFailing"`
+
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorTime *time.Time `json:"lastErrorTime,omitempty"`
+}
+
+// sentryStats tracks the state and stats of a remote signer from its events.
+type sentryStats struct {
+	mu    sync.Mutex
+	state SentryState
+	stats SentryStats
+}
+
+func newSentryStats() *sentryStats {
+	return &sentryStats{
+		state: SentryConnecting,
+		stats: SentryStats{Started: time.Now()},
+	}
+}
+
+// handle is the signer.RemoteSignerEventHandler that updates the stats.
+func (s *sentryStats) handle(event signer.RemoteSignerEvent, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	switch event {
+	case signer.RemoteSignerConnected:
+		s.state = SentryConnected
+		s.stats.ConnectedSince = &now
+		s.stats.Connects++
+	case signer.RemoteSignerDisconnected:
+		s.state = SentryDisconnected
+		s.stats.ConnectedSince = nil
+		s.stats.Disconnects++
+	case signer.RemoteSignerHandshakeFailed:
+		s.state = SentryHandshakeFailed
+		s.stats.HandshakeFailures++
+	case signer.RemoteSignerRequestsFailing:
+		s.stats.RequestsFailing++
+	}
+	if err != nil {
+		s.stats.LastError = err.Error()
+		s.stats.LastErrorTime = &now
+	}
+}
+
+// get returns the state and stats.
+func (s *sentryStats) get() (SentryState, SentryStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state, s.stats
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+)
+
+// topologySelector selects the sentry pods on this node. If topology keys are
+// configured, it instead selects the pods in the narrowest topology domain
+// around this node that has a healthy (Ready) sentry: this node first, then
+// the domains of the topology keys in order.
+type topologySelector struct {
+	node       string
+	keys       []string
+	nodeLister corelisters.NodeLister
+}
+
+// selectPods returns the pods of one sentry Service to connect to, and the
+// topology domain they were selected from.
+func (ts topologySelector) selectPods(pods []*corev1.Pod) ([]*corev1.Pod, string) {
+	if len(ts.keys) == 0 {
+		var selected []*corev1.Pod
+		for _, pod := range pods {
+			if pod.Spec.NodeName == ts.node {
+				selected = append(selected, pod)
+			}
+		}
+		return selected, corev1.LabelHostname
+	}
+
+	inDomain := func(match func(pod *corev1.Pod) bool) []*corev1.Pod {
+		var selected []*corev1.Pod
+		healthy := false
+		for _, pod := range pods {
+			if match(pod) {
+				selected = append(selected, pod)
+				healthy = healthy || podReady(pod)
+			}
+		}
+		if !healthy {
+			return nil
+		}
+		return selected
+	}
+
+	if selected := inDomain(func(pod *corev1.Pod) bool { return pod.Spec.NodeName == ts.node }); len(selected) > 0 {
+		return selected, corev1.LabelHostname
+	}
+
+	thisNode, err := ts.nodeLister.Get(ts.node)
+	if err != nil {
+		return nil, ""
+	}
+
+	for _, key := range ts.keys {
+		value, ok := thisNode.Labels[key]
+		if !ok {
+			continue
+		}
+
+		selected := inDomain(func(pod *corev1.Pod) bool {
+			node, err := ts.nodeLister.Get(pod.Spec.NodeName)
+			if err != nil {
+				return false
+			}
+			return node.Labels[key] == value
+		})
+		if len(selected) > 0 {
+			return selected, key
+		}
+	}
+
+	return nil, ""
+}
+
+// podReadySince returns when the pod last became Ready.
+func podReadySince(pod *corev1.Pod) time.Time {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.LastTransitionTime.Time
+		}
+	}
+	return time.Time{}
+}
+
+// podReady reports whether the pod has the Ready condition.
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
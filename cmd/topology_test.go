@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestTopologySelector(t *testing.T) {
+	const (
+		zone   = "topology.kubernetes.io/zone"
+		region = "topology.kubernetes.io/region"
+	)
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for name, lbls := range map[string]map[string]string{
+		"node-a": {zone: "us-east-1a", region: "us-east-1"},
+		"node-b": {zone: "us-east-1a", region: "us-east-1"},
+		"node-c": {zone: "us-east-1b", region: "us-east-1"},
+		"node-d": {zone: "us-west-1a", region: "us-west-1"},
+	} {
+		require.NoError(t, indexer.Add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: lbls}}))
+	}
+
+	pod := func(name, node string, ready bool) *corev1.Pod {
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       corev1.PodSpec{NodeName: node},
+			Status: corev1.PodStatus{Conditions: []corev1.PodCondition{
+				{Type: corev1.PodReady, Status: status},
+			}},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		keys       []string
+		pods       []*corev1.Pod
+		wantPods   []string
+		wantDomain string
+	}{
+		{
+			name:       "node only",
+			pods:       []*corev1.Pod{pod("a", "node-a", false), pod("b", "node-b", true)},
+			wantPods:   []string{"a"},
+			wantDomain: corev1.LabelHostname,
+		},
+		{
+			name:       "healthy sentry on this node",
+			keys:       []string{zone, region},
+			pods:       []*corev1.Pod{pod("a", "node-a", true), pod("b", "node-b", true)},
+			wantPods:   []string{"a"},
+			wantDomain: corev1.LabelHostname,
+		},
+		{
+			name:       "fall back to zone",
+			keys:       []string{zone, region},
+			pods:       []*corev1.Pod{pod("a", "node-a", false), pod("b", "node-b", true), pod("c", "node-c", true)},
+			wantPods:   []string{"a", "b"},
+			wantDomain: zone,
+		},
+		{
+			name:       "fall back to region",
+			keys:       []string{zone, region},
+			pods:       []*corev1.Pod{pod("c", "node-c", true), pod("d", "node-d", true)},
+			wantPods:   []string{"c"},
+			wantDomain: region,
+		},
+		{
+			name: "no healthy sentry in any domain",
+			keys: []string{zone, region},
+			pods: []*corev1.Pod{pod("c", "node-c", false), pod("d", "node-d", true)},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ts := topologySelector{
+				node:       "node-a",
+				keys:       tt.keys,
+				nodeLister: corelisters.NewNodeLister(indexer),
+			}
+
+			pods, domain := ts.selectPods(tt.pods)
+
+			names := make([]string, len(pods))
+			for i, p := range pods {
+				names[i] = p.Name
+			}
+			require.ElementsMatch(t, tt.wantPods, names)
+			require.Equal(t, tt.wantDomain, domain)
+		})
+	}
+}
@@ -5,39 +5,140 @@ import (
 	"errors"
 	"fmt"
 	"net"
-	"os"
-	"strings"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 
 	cometlog "github.com/cometbft/cometbft/libs/log"
 	"github.com/strangelove-ventures/horcrux-proxy/signer"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 const (
 	namespaceFile     = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
 	labelCosmosSentry = "app.kubernetes.io/component=cosmos-sentry"
+
+	// resyncInterval is how often sentries are reconciled even if no
+	// Service or Pod events were received.
+	resyncInterval = 30 * time.Second
 )
 
+// RemoteSigner is a connection to the privval listener of a sentry that
+// forwards its signing requests to horcrux.
+type RemoteSigner interface {
+	Start() error
+	Stop() error
+}
+
+// SignerFactory returns the RemoteSigner of the sentry at the address. It has
+// the signature of signer.NewReconnRemoteSigner.
+type SignerFactory func(
+	address string,
+	logger cometlog.Logger,
+	hc signer.HorcruxConnection,
+	dialer net.Dialer,
+	maxReadSize int,
+	opts ...signer.ReconnRemoteSignerOption,
+) RemoteSigner
+
+// newReconnRemoteSigner is the default SignerFactory.
+func newReconnRemoteSigner(
+	address string,
+	logger cometlog.Logger,
+	hc signer.HorcruxConnection,
+	dialer net.Dialer,
+	maxReadSize int,
+	opts ...signer.ReconnRemoteSignerOption,
+) RemoteSigner {
+	return signer.NewReconnRemoteSigner(address, logger, hc, dialer, maxReadSize, opts...)
+}
+
+// SentryWatcherOption configures a SentryWatcher.
+type SentryWatcherOption func(*SentryWatcher)
+
+// SentryWatcherSignerFactory sets the factory of the remote signers of the
+// sentries, e.g. to a fake in tests. Defaults to signer.NewReconnRemoteSigner.
+func SentryWatcherSignerFactory(newSigner SignerFactory) SentryWatcherOption {
+	return func(w *SentryWatcher) {
+		w.newSigner = newSigner
+	}
+}
+
+// SentryWatcherDialTimeout sets the default timeout for dialing sentries.
+// Defaults to 2s.
+func SentryWatcherDialTimeout(timeout time.Duration) SentryWatcherOption {
+	return func(w *SentryWatcher) {
+		w.dialTimeout = timeout
+	}
+}
+
+// SentryWatcherDNS sets the DNS names of sentries to discover, in addition to
+// the sentries in kubernetes.
+func SentryWatcherDNS(opts DNSOptions) SentryWatcherOption {
+	return func(w *SentryWatcher) {
+		w.dnsOpts = opts
+	}
+}
+
+// SentryWatcherFiles sets the sentry files to discover sentries in, in
+// addition to the sentries in kubernetes.
+func SentryWatcherFiles(opts FileOptions) SentryWatcherOption {
+	return func(w *SentryWatcher) {
+		w.fileOpts = opts
+	}
+}
+
+// SentryWatcherRemovalGrace sets how long sentries that are no longer
+// discovered stay connected, so a sentry that is missing from a single list
+// result doesn't have to handshake again. Defaults to 0, removing them right
+// away.
+func SentryWatcherRemovalGrace(grace time.Duration) SentryWatcherOption {
+	return func(w *SentryWatcher) {
+		w.removalGrace = grace
+	}
+}
+
+// SentryWatcherHTTP sets the sentry URL to discover sentries from, in addition
+// to the sentries in kubernetes.
+func SentryWatcherHTTP(opts HTTPOptions) SentryWatcherOption {
+	return func(w *SentryWatcher) {
+		w.httpOpts = opts
+	}
+}
+
+// SentryWatcher connects to the sentries of all the sources, i.e. the static
+// sentries and its Discoverers, through a sentryReconciler.
 type SentryWatcher struct {
-	all                bool
-	client             *kubernetes.Clientset
-	hc                 signer.HorcruxConnection
-	labels             string
-	log                cometlog.Logger
-	node               string
-	operator           bool
-	persistentSentries []*signer.ReconnRemoteSigner
-	sentries           map[string]*signer.ReconnRemoteSigner
+	*kubeDiscovery
+
+	dialTimeout time.Duration
+	discoverers []Discoverer
+	dnsOpts     DNSOptions
+	fileOpts    FileOptions
+	hc          signer.HorcruxConnection
+	httpOpts    HTTPOptions
+	log         cometlog.Logger
+	maxReadSize int
+	newSigner   SignerFactory
+	operator    bool
+	reconciler  *sentryReconciler
+
+	removalGrace time.Duration
 
 	stop chan struct{}
 	done chan struct{}
 }
 
+// NewSentryWatcher returns a SentryWatcher. If operator is true, sentries are
+// discovered through the kube api configured by kubeOpts, or through
+// kubeOpts.Client if set. Sentries are also discovered in each of the kubeOpts
+// clusters, regardless of operator.
 func NewSentryWatcher(
 	ctx context.Context,
 	labels []string,
@@ -45,204 +146,584 @@ func NewSentryWatcher(
 	all bool, // should we connect to sentries on all nodes, or just this node?
 	hc signer.HorcruxConnection,
 	operator bool,
-	sentries []string,
+	kubeOpts KubeOptions,
+	sentries []StaticSentry,
 	maxReadSize int,
-) (*SentryWatcher, error) {
-	var clientset *kubernetes.Clientset
-	var thisNode string
+	opts ...SentryWatcherOption,
+) (_ *SentryWatcher, err error) {
+	w := &SentryWatcher{
+		done:        make(chan struct{}),
+		hc:          hc,
+		log:         logger,
+		maxReadSize: maxReadSize,
+		newSigner:   newReconnRemoteSigner,
+		operator:    operator,
+		stop:        make(chan struct{}),
+	}
 
-	if operator {
-		config, err := rest.InClusterConfig()
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	if w.removalGrace < 0 {
+		return nil, fmt.Errorf("invalid removal grace %s", w.removalGrace)
+	}
+
+	w.reconciler = newSentryReconciler(hc, logger, w.newSigner, sourceAPI, sourceStatic, sourceKube, sourceFile, sourceHTTP, sourceDNS)
+	w.reconciler.removalGrace = w.removalGrace
+	w.kubeDiscovery = newKubeDiscovery(logger, maxReadSize, w.defaultSentryConfig, w.reconciler.updater(sourceKube))
+
+	// Stop is never called on a watcher that fails to build, stop recording
+	// the Events of the clusters added so far.
+	defer func() {
 		if err != nil {
-			return nil, fmt.Errorf("failed to get in cluster config: %w", err)
+			w.shutdownEvents()
 		}
-		// creates the clientset
-		clientset, err = kubernetes.NewForConfig(config)
+	}()
+
+	if err := w.SetStaticSentries(sentries); err != nil {
+		return nil, err
+	}
+
+	if operator {
+		local, ns, err := kubeOpts.newCluster("", all, labels, logger)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create kube clientset: %w", err)
+			return nil, err
 		}
+		w.addCluster(local)
 
+		var thisNode string
 		if !all {
 			// need to determine which node this pod is on so we can only connect to sentries on this node
-
-			nsbz, err := os.ReadFile(namespaceFile)
+			thisNode, err = kubeOpts.nodeName(ctx, local.client, ns)
 			if err != nil {
-				return nil, fmt.Errorf("failed to read namespace from service account: %w", err)
+				return nil, err
 			}
-			ns := string(nsbz)
+		}
+		if err := local.setTopology(thisNode, kubeOpts.TopologyKeys); err != nil {
+			return nil, err
+		}
 
-			thisPod, err := clientset.CoreV1().Pods(ns).Get(ctx, os.Getenv("HOSTNAME"), metav1.GetOptions{})
+		if kubeOpts.Shard.Group != "" {
+			shardOpts := kubeOpts.Shard
+			if shardOpts.Namespace == "" {
+				shardOpts.Namespace = ns
+			}
+			shard, err := newShardCoordinator(local.client, shardOpts, logger, w.enqueue)
 			if err != nil {
-				return nil, fmt.Errorf("failed to get this pod: %w", err)
+				return nil, err
 			}
+			w.shard = shard
+		}
+	}
 
-			thisNode = thisPod.Spec.NodeName
+	for _, clusterOpts := range kubeOpts.Clusters {
+		opts := KubeOptions{
+			Kubeconfig: clusterOpts.Kubeconfig,
+			Context:    clusterOpts.Context,
+			Namespaces: kubeOpts.Namespaces,
+			Discovery:  kubeOpts.Discovery,
+			Selector:   kubeOpts.Selector,
+			ReadyGrace: kubeOpts.ReadyGrace,
+		}
+		// The node of this pod is meaningless in other clusters, connect to sentries on all nodes.
+		c, _, err := opts.newCluster(clusterOpts.Name, true, clusterOpts.Labels, logger.With("cluster", clusterOpts.Name))
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s: %w", clusterOpts.Name, err)
 		}
+		w.addCluster(c)
+	}
+
+	if len(w.clusters) > 0 {
+		w.discoverers = append(w.discoverers, w.kubeDiscovery)
 	}
 
-	persistentSentries := make([]*signer.ReconnRemoteSigner, len(sentries))
-	for i, sentry := range sentries {
-		dialer := net.Dialer{Timeout: 2 * time.Second}
-		persistentSentries[i] = signer.NewReconnRemoteSigner(sentry, logger, hc, dialer, maxReadSize)
+	defaults := w.defaultSentryConfig(maxReadSize)
+
+	if w.fileOpts.enabled() {
+		files, err := newFileDiscovery(w.fileOpts, defaults, logger)
+		if err != nil {
+			return nil, err
+		}
+		w.discoverers = append(w.discoverers, files)
 	}
 
-	uniqueLabelMap := make(map[string]bool)
-	labels = append(labels, labelCosmosSentry)
-	finalLabels := []string{}
-	for _, label := range labels {
-		if _, exists := uniqueLabelMap[label]; !exists {
-			uniqueLabelMap[label] = true
-			finalLabels = append(finalLabels, label)
+	if w.httpOpts.enabled() {
+		sentryURL, err := newHTTPDiscovery(w.httpOpts, defaults, logger)
+		if err != nil {
+			return nil, err
 		}
+		w.discoverers = append(w.discoverers, sentryURL)
 	}
 
-	return &SentryWatcher{
-		all:                all,
-		client:             clientset,
-		done:               make(chan struct{}),
-		hc:                 hc,
-		labels:             strings.Join(finalLabels, ","),
-		log:                logger,
-		node:               thisNode,
-		operator:           operator,
-		persistentSentries: persistentSentries,
-		sentries:           make(map[string]*signer.ReconnRemoteSigner),
-		stop:               make(chan struct{}),
-	}, nil
+	if w.dnsOpts.enabled() {
+		dns, err := newDNSDiscovery(w.dnsOpts, defaults, logger)
+		if err != nil {
+			return nil, err
+		}
+		w.discoverers = append(w.discoverers, dns)
+	}
+
+	return w, nil
+}
+
+// defaultSentryConfig returns the configuration of sentries without settings.
+func (w *SentryWatcher) defaultSentryConfig(maxReadSize int) sentryConfig {
+	c := defaultSentryConfig(maxReadSize)
+	if w.dialTimeout > 0 {
+		c.dialTimeout = w.dialTimeout
+	}
+	return c
 }
 
-// Watch will reconcile the sentries with the kube api at a reasonable interval.
-// It must be called only once.
+// Watch connects to the static sentries and runs the Discoverers, until Stop is
+// called. It must be called only once.
 func (w *SentryWatcher) Watch(ctx context.Context, maxReadSize int) {
-	for _, sentry := range w.persistentSentries {
-		if err := sentry.Start(); err != nil {
-			w.log.Error("Failed to start persistent sentry", "error", err)
+	defer close(w.done)
+
+	w.kubeDiscovery.maxReadSize = maxReadSize
+	w.reconciler.start()
+
+	var wg sync.WaitGroup
+	for _, d := range w.discoverers {
+		wg.Add(1)
+		go func(d Discoverer) {
+			defer wg.Done()
+			d.Run(ctx, w.stop, w.reconciler.updater(d.Name()))
+		}(d)
+	}
+	wg.Wait()
+}
+
+// Stop cleans up the sentries and stops the watcher. It must be called only once.
+func (w *SentryWatcher) Stop() error {
+	close(w.stop)
+	<-w.done
+	err := w.reconciler.stop()
+	w.shutdownEvents()
+	return err
+}
+
+// shutdownEvents stops recording Events in all clusters.
+func (w *SentryWatcher) shutdownEvents() {
+	for _, c := range w.clusters {
+		c.events.shutdown()
+	}
+}
+
+// kubeDiscovery is the Discoverer of the sentries of one or more clusters,
+// through the kube api.
+type kubeDiscovery struct {
+	clusters    []*kubeCluster
+	defaults    func(maxReadSize int) sentryConfig
+	log         cometlog.Logger
+	maxReadSize int
+	shard       *shardCoordinator
+	trigger     chan struct{}
+	update      SentryUpdate
+
+	// discovered are the sentries of the last reconcile, keyed by
+	// sentryEndpoint.key.
+	discovered map[string]desiredSentry
+
+	resultMu   sync.Mutex
+	lastResult ReconcileResult
+}
+
+var _ Discoverer = (*kubeDiscovery)(nil)
+
+// newKubeDiscovery returns a kubeDiscovery without clusters, that passes the
+// sentries it discovers, configured by defaults, to update.
+func newKubeDiscovery(
+	logger cometlog.Logger,
+	maxReadSize int,
+	defaults func(maxReadSize int) sentryConfig,
+	update SentryUpdate,
+) *kubeDiscovery {
+	return &kubeDiscovery{
+		defaults:    defaults,
+		discovered:  make(map[string]desiredSentry),
+		log:         logger,
+		maxReadSize: maxReadSize,
+		trigger:     make(chan struct{}, 1),
+		update:      update,
+	}
+}
+
+// Name implements Discoverer.
+func (k *kubeDiscovery) Name() string {
+	return sourceKube
+}
+
+// addCluster adds a cluster that feeds its sentries into the discovery.
+func (k *kubeDiscovery) addCluster(c *kubeCluster) {
+	c.enqueue = k.enqueue
+	k.clusters = append(k.clusters, c)
+}
+
+// uniqueNamespaces dedupes the namespaces. If any of them is
+// metav1.NamespaceAll, only metav1.NamespaceAll is returned.
+func uniqueNamespaces(namespaces []string) []string {
+	seen := make(map[string]bool)
+	unique := make([]string, 0, len(namespaces))
+	for _, ns := range namespaces {
+		if ns == metav1.NamespaceAll {
+			return []string{metav1.NamespaceAll}
+		}
+		if !seen[ns] {
+			seen[ns] = true
+			unique = append(unique, ns)
 		}
 	}
-	if !w.operator {
-		return
+	return unique
+}
+
+// enqueue requests a reconcile without blocking. Multiple requests made while
+// a reconcile is pending are coalesced.
+func (k *kubeDiscovery) enqueue() {
+	select {
+	case k.trigger <- struct{}{}:
+	default:
 	}
-	defer close(w.done)
-	const interval = 30 * time.Second
-	timer := time.NewTimer(interval)
+}
+
+// Run implements Discoverer. It reconciles the sentries with the kube api
+// whenever a Service or Pod changes, and at a reasonable interval as a safety
+// net.
+func (k *kubeDiscovery) Run(ctx context.Context, stop <-chan struct{}, update SentryUpdate) {
+	k.update = update
+
+	for _, c := range k.clusters {
+		if c.name == "" {
+			c.startInformers(stop)
+			continue
+		}
+		// Another cluster may be unreachable, don't hold up discovery in the others.
+		go func(c *kubeCluster) {
+			c.startInformers(stop)
+			k.enqueue()
+		}(c)
+	}
+
+	if k.shard != nil {
+		k.shard.start(ctx, stop)
+		shardDone := make(chan struct{})
+		go func() {
+			defer close(shardDone)
+			k.shard.run(ctx, stop)
+		}()
+		// Release the shard lease before the discovery is done.
+		defer func() { <-shardDone }()
+	}
+
+	timer := time.NewTimer(resyncInterval)
 	defer timer.Stop()
 
 	for {
-		if err := w.reconcileSentries(ctx, maxReadSize); err != nil {
-			w.log.Error("Failed to reconcile sentries with kube api", "error", err)
+		if err := k.reconcileSentries(ctx, k.maxReadSize); err != nil {
+			k.log.Error("Failed to reconcile sentries with kube api", "error", err)
 		}
 		select {
-		case <-w.stop:
+		case <-stop:
 			return
 		case <-ctx.Done():
 			return
+		case <-k.trigger:
 		case <-timer.C:
-			timer.Reset(interval)
 		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(resyncInterval)
 	}
 }
 
-// Stop cleans up the sentries and stops the watcher. It must be called only once.
-func (w *SentryWatcher) Stop() error {
-	// The dual channel synchronization ensures w.sentries is only read/mutated by one goroutine.
-	close(w.stop)
-	<-w.done
-	var err error
-	for _, sentry := range w.persistentSentries {
-		err = errors.Join(err, sentry.Stop())
+// ReconcileResult is the outcome of a reconcile of the discovered sentries.
+type ReconcileResult struct {
+	// Time is when the reconcile finished.
+	Time time.Time
+
+	// Sentries is the number of discovered sentries with a running remote signer.
+	Sentries int
+
+	// Errors are keyed by the namespace, Service (namespace/name) or sentry
+	// address they occurred for, prefixed by "cluster/" for sentries of other
+	// clusters. Failed sentries are retried on the next reconcile.
+	Errors map[string]error
+}
+
+// Err returns the errors of the reconcile joined together, or nil.
+func (r ReconcileResult) Err() error {
+	keys := make([]string, 0, len(r.Errors))
+	for k := range r.Errors {
+		keys = append(keys, k)
 	}
-	for _, sentry := range w.sentries {
-		err = errors.Join(err, sentry.Stop())
+	sort.Strings(keys)
+
+	errs := make([]error, len(keys))
+	for i, k := range keys {
+		errs[i] = fmt.Errorf("%s: %w", k, r.Errors[k])
 	}
-	return err
+	return errors.Join(errs...)
+}
+
+// LastReconcile returns the result of the last reconcile, e.g. for health reporting.
+func (k *kubeDiscovery) LastReconcile() ReconcileResult {
+	k.resultMu.Lock()
+	defer k.resultMu.Unlock()
+	return k.lastResult
 }
 
-func (w *SentryWatcher) reconcileSentries(
+// reconcileSentries updates the sentries to match those discovered through the
+// kube api. A failure for one namespace, Service or sentry does not affect the
+// others: sentries of a namespace or Service that could not be listed are kept
+// as they are, and sentries that failed to start are retried on the next call.
+func (k *kubeDiscovery) reconcileSentries(
 	ctx context.Context,
 	maxReadSize int,
 ) error {
-	configNodes := make([]string, 0)
+	result := ReconcileResult{Errors: make(map[string]error)}
+
+	configNodes := make(map[string]sentryEndpoint)
+	unavailable := make(map[string]bool)
+
+	defaults := k.defaults(maxReadSize)
+
+	for _, c := range k.clusters {
+		endpoints, errs, available := c.discover(defaults)
+		if !available {
+			unavailable[clusterKey(c.name, metav1.NamespaceAll)] = true
+		}
+		for key, err := range errs {
+			result.Errors[key] = err
+			unavailable[key] = true
+		}
+		for _, e := range endpoints {
+			configNodes[e.key()] = e
+		}
+	}
+
+	owns := func(string) bool { return true }
+	if k.shard != nil {
+		var err error
+		owns, err = k.shard.owners()
+		if err != nil {
+			// Without a live lease, other replicas may own any sentry.
+			result.Errors["shard"] = err
+			owns = func(string) bool { return false }
+		}
+	}
+
+	// Sentries that other replicas own are recorded, so that they are removed
+	// right away rather than after the removal grace.
+	unowned := make(map[*kubeCluster]map[string]bool, len(k.clusters))
+	for _, c := range k.clusters {
+		unowned[c] = make(map[string]bool)
+	}
+	for key, e := range configNodes {
+		if !owns(key) {
+			unowned[e.cluster][e.address] = true
+			delete(configNodes, key)
+		}
+	}
+
+	discovered := make(map[string]desiredSentry, len(configNodes))
+	for key, e := range configNodes {
+		e := e
+		discovered[key] = desiredSentry{address: e.address, config: e.config, log: e.cluster.log, endpoint: &e}
+	}
+
+	for key, s := range k.discovered {
+		if _, exists := discovered[key]; exists {
+			continue
+		}
+		e := s.endpoint
+		cluster := e.cluster.name
+		if !owns(key) {
+			if addresses, ok := unowned[e.cluster]; ok {
+				addresses[e.address] = true
+			}
+			continue
+		}
+		if unavailable[clusterKey(cluster, metav1.NamespaceAll)] ||
+			unavailable[clusterKey(cluster, e.namespace)] ||
+			unavailable[clusterKey(cluster, e.serviceKey())] {
+			// The sentry may still exist, keep it until its Service can be listed again.
+			discovered[key] = s
+		}
+	}
+	k.discovered = discovered
+	for c, addresses := range unowned {
+		c.setUnowned(addresses)
+	}
+
+	result.Sentries = len(discovered)
+	for key, err := range k.update(discovered) {
+		result.Errors[key] = err
+		if _, exists := discovered[key]; exists {
+			result.Sentries--
+		}
+	}
 
-	services, err := w.client.CoreV1().Services("").List(ctx, metav1.ListOptions{
-		LabelSelector: w.labels,
-	})
+	result.Time = time.Now()
+	k.resultMu.Lock()
+	k.lastResult = result
+	k.resultMu.Unlock()
 
+	return result.Err()
+}
+
+// sentryEndpoint is the privval endpoint of a single sentry pod.
+type sentryEndpoint struct {
+	cluster   *kubeCluster
+	address   string
+	namespace string
+	service   string
+	pod       string
+	podUID    types.UID
+	node      string
+	config    sentryConfig
+}
+
+// key identifies the sentry across clusters.
+func (e sentryEndpoint) key() string {
+	return clusterKey(e.cluster.name, e.address)
+}
+
+// serviceKey returns the namespace/name key of the sentry Service.
+func (e sentryEndpoint) serviceKey() string {
+	return e.namespace + "/" + e.service
+}
+
+// sentriesInNamespace returns the privval endpoints of the sentry pods
+// discovered by the informers of one namespace, configured by the annotations
+// of their Service over the defaults. Errors are keyed by the namespace or
+// Service (namespace/name) whose sentries could not be listed or configured.
+func (c *kubeCluster) sentriesInNamespace(
+	inf namespaceInformers,
+	defaults sentryConfig,
+) ([]sentryEndpoint, map[string]error) {
+	errs := make(map[string]error)
+
+	services, err := inf.serviceLister.List(labels.Everything())
 	if err != nil {
-		return fmt.Errorf("failed to list services: %w", err)
+		errs[inf.namespace] = fmt.Errorf("failed to list services: %w", err)
+		return nil, errs
 	}
 
-	for _, s := range services.Items {
-		if len(s.Spec.Ports) != 1 || s.Spec.Ports[0].Name != "sentry-privval" {
+	var endpoints []sentryEndpoint
+	for _, s := range services {
+		if !c.selector.Matches(labels.Set(s.Labels)) {
 			continue
 		}
 
-		set := labels.Set(s.Spec.Selector)
+		if ignoreService(s.Annotations) {
+			continue
+		}
 
-		pods, err := w.client.CoreV1().Pods(s.Namespace).List(ctx, metav1.ListOptions{LabelSelector: set.AsSelector().String()})
+		svcPort, ok, err := servicePrivvalPort(s)
 		if err != nil {
-			return fmt.Errorf("failed to list pods in namespace %s for service %s: %w", s.Namespace, s.Name, err)
+			errs[s.Namespace+"/"+s.Name] = err
+			continue
 		}
-
-		if len(pods.Items) != 1 {
+		if !ok {
 			continue
 		}
 
-		if !w.all && pods.Items[0].Spec.NodeName != w.node {
+		config, err := parseSentryConfig(s.Annotations, defaults)
+		if err != nil {
+			errs[s.Namespace+"/"+s.Name] = err
 			continue
 		}
 
-		// Connect to this service
-		configNodes = append(configNodes, fmt.Sprintf("tcp://%s.%s:%d", s.Name, s.Namespace, s.Spec.Ports[0].Port))
-	}
+		set := labels.Set(s.Spec.Selector)
 
-	newSentries := make([]string, 0)
+		pods, err := inf.podLister.Pods(s.Namespace).List(set.AsSelector())
+		if err != nil {
+			errs[s.Namespace+"/"+s.Name] = fmt.Errorf("failed to list pods: %w", err)
+			continue
+		}
+
+		pods = c.readyPods(pods)
 
-	for _, newConfigSentry := range configNodes {
-		foundNewConfigSentry := false
-		for existingSentry := range w.sentries {
-			if existingSentry == newConfigSentry {
-				foundNewConfigSentry = true
-				break
+		if !c.all {
+			var domain string
+			pods, domain = c.topology.selectPods(pods)
+			if len(pods) > 0 && domain != corev1.LabelHostname {
+				c.log.Debug("No healthy sentry on this node, using wider topology domain",
+					"namespace", s.Namespace, "service", s.Name, "topology", domain)
 			}
 		}
-		if !foundNewConfigSentry {
-			w.log.Info("Will add new sentry", "address", newConfigSentry)
-			newSentries = append(newSentries, newConfigSentry)
-		}
-	}
 
-	removedSentries := make([]string, 0)
+		for _, pod := range pods {
+			if pod.Status.PodIP == "" {
+				continue
+			}
 
-	for existingSentry := range w.sentries {
-		foundExistingSentry := false
-		for _, newConfigSentry := range configNodes {
-			if existingSentry == newConfigSentry {
-				foundExistingSentry = true
-				break
+			port, ok := podPrivvalPort(svcPort, pod)
+			if !ok {
+				c.log.Error("Failed to find privval port of sentry pod", "namespace", pod.Namespace, "pod", pod.Name)
+				continue
 			}
-		}
-		if !foundExistingSentry {
-			w.log.Info("Will remove existing sentry", "address", existingSentry)
-			removedSentries = append(removedSentries, existingSentry)
+
+			// Connect to this pod
+			endpoints = append(endpoints, sentryEndpoint{
+				cluster:   c,
+				address:   "tcp://" + net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(port))),
+				namespace: s.Namespace,
+				service:   s.Name,
+				pod:       pod.Name,
+				podUID:    pod.UID,
+				node:      pod.Spec.NodeName,
+				config:    config,
+			})
 		}
 	}
 
-	for _, s := range removedSentries {
-		if err := w.sentries[s].Stop(); err != nil {
-			return fmt.Errorf("failed to stop remote signer: %w", err)
+	return endpoints, errs
+}
+
+// servicePrivvalPort returns the port of the Service to connect to its pods on,
+// and false if the Service is not a sentry Service. Without the port-name
+// annotation, it must have a single sentry-privval port.
+func servicePrivvalPort(s *corev1.Service) (corev1.ServicePort, bool, error) {
+	if _, ok := s.Annotations[annotationPortName]; !ok {
+		if len(s.Spec.Ports) != 1 || s.Spec.Ports[0].Name != sentryPrivvalPortName {
+			return corev1.ServicePort{}, false, nil
 		}
-		delete(w.sentries, s)
+		return s.Spec.Ports[0], true, nil
 	}
 
-	for _, newSentry := range newSentries {
-		dialer := net.Dialer{Timeout: 2 * time.Second}
-		s := signer.NewReconnRemoteSigner(newSentry, w.log, w.hc, dialer, maxReadSize)
-
-		if err := s.Start(); err != nil {
-			return fmt.Errorf("failed to start new remote signer(s): %w", err)
+	name, err := portName(s.Annotations, sentryPrivvalPortName)
+	if err != nil {
+		return corev1.ServicePort{}, false, err
+	}
+	for _, p := range s.Spec.Ports {
+		if p.Name == name {
+			return p, true, nil
 		}
-		w.sentries[newSentry] = s
 	}
+	return corev1.ServicePort{}, false, fmt.Errorf("no port named %q of the %s annotation", name, annotationPortName)
+}
 
-	return nil
+// podPrivvalPort resolves the target port of the service port on the pod.
+func podPrivvalPort(svcPort corev1.ServicePort, pod *corev1.Pod) (int32, bool) {
+	switch {
+	case svcPort.TargetPort.Type == intstr.String:
+		for _, c := range pod.Spec.Containers {
+			for _, p := range c.Ports {
+				if p.Name == svcPort.TargetPort.StrVal {
+					return p.ContainerPort, true
+				}
+			}
+		}
+		return 0, false
+	case svcPort.TargetPort.IntVal != 0:
+		return svcPort.TargetPort.IntVal, true
+	default:
+		return svcPort.Port, true
+	}
 }
@@ -0,0 +1,986 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+
+	"github.com/strangelove-ventures/horcrux-proxy/signer"
+)
+
+// newTestWatcher returns a SentryWatcher without clusters, whose reconciler is
+// started.
+func newTestWatcher() *SentryWatcher {
+	logger := cometlog.NewNopLogger()
+	w := &SentryWatcher{
+		log:       logger,
+		newSigner: newReconnRemoteSigner,
+		operator:  true,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	w.reconciler = newSentryReconciler(nil, logger, w.newSigner, sourceStatic, sourceKube)
+	w.reconciler.start()
+	w.kubeDiscovery = newKubeDiscovery(logger, 0, w.defaultSentryConfig, w.reconciler.updater(sourceKube))
+	return w
+}
+
+// testSelector returns the sentry selector of the labels with the default options.
+func testSelector(labelSelectors ...string) sentrySelector {
+	s, err := newSentrySelector(labelSelectors, SelectorOptions{})
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func sentryService(name, namespace string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{"app.kubernetes.io/component": "cosmos-sentry"},
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app.kubernetes.io/instance": name},
+			Ports:    []corev1.ServicePort{{Name: "sentry-privval", Port: 1234}},
+		},
+	}
+}
+
+func sentryPod(name, namespace, instance, node, ip string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{"app.kubernetes.io/instance": instance},
+		},
+		Spec: corev1.PodSpec{NodeName: node},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			PodIP: ip,
+			Conditions: []corev1.PodCondition{
+				{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+			},
+		},
+	}
+}
+
+func TestSentryWatcherInformers(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+
+	w := newTestWatcher()
+	c := &kubeCluster{
+		all:      true,
+		selector: testSelector(),
+		log:      cometlog.NewNopLogger(),
+	}
+	w.addCluster(c)
+	require.NoError(t, c.setClient(client, []string{"default"}))
+
+	c.startInformers(w.stop)
+	t.Cleanup(func() {
+		close(w.stop)
+		_ = w.reconciler.stop()
+	})
+
+	// drain the trigger from the initial (empty) sync
+	select {
+	case <-w.trigger:
+	default:
+	}
+
+	_, err := client.CoreV1().Pods("default").Create(ctx, sentryPod("sentry-0", "default", "sentry", "node-a", "10.0.0.1"), metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = client.CoreV1().Services("default").Create(ctx, sentryService("sentry", "default"), metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	select {
+	case <-w.trigger:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected reconcile to be triggered by informer event")
+	}
+
+	require.Eventually(t, func() bool {
+		svcs, _ := c.informers[0].serviceLister.List(labels.Everything())
+		return len(svcs) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, w.reconcileSentries(ctx, 1024))
+	require.Contains(t, w.reconciler.sentries, "tcp://10.0.0.1:1234")
+
+	require.NoError(t, client.CoreV1().Services("default").Delete(ctx, "sentry", metav1.DeleteOptions{}))
+	require.Eventually(t, func() bool {
+		svcs, _ := c.informers[0].serviceLister.List(labels.Everything())
+		return len(svcs) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, w.reconcileSentries(ctx, 1024))
+	require.Empty(t, w.reconciler.sentries)
+}
+
+func TestSentryWatcherRemovalGrace(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset(
+		sentryService("sentry", "default"), sentryPod("sentry-0", "default", "sentry", "node-a", "10.0.0.1"),
+	)
+
+	w := newTestWatcher()
+	w.reconciler.removalGrace = time.Hour
+	c := &kubeCluster{
+		all:      true,
+		selector: testSelector(),
+		log:      cometlog.NewNopLogger(),
+	}
+	w.addCluster(c)
+	require.NoError(t, c.setClient(client, []string{"default"}))
+	c.startInformers(w.stop)
+	t.Cleanup(func() {
+		close(w.stop)
+		_ = w.reconciler.stop()
+	})
+
+	require.NoError(t, w.reconcileSentries(ctx, 1024))
+	sentry := w.reconciler.sentries["tcp://10.0.0.1:1234"]
+	require.NotNil(t, sentry)
+
+	// The Service briefly disappears, the sentry stays connected.
+	require.NoError(t, client.CoreV1().Services("default").Delete(ctx, "sentry", metav1.DeleteOptions{}))
+	require.Eventually(t, func() bool {
+		svcs, _ := c.informers[0].serviceLister.List(labels.Everything())
+		return len(svcs) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, w.reconcileSentries(ctx, 1024))
+	require.Same(t, sentry, w.reconciler.sentries["tcp://10.0.0.1:1234"])
+	require.False(t, sentry.removeAt.IsZero())
+
+	// It comes back, the removal is cancelled.
+	_, err := client.CoreV1().Services("default").Create(ctx, sentryService("sentry", "default"), metav1.CreateOptions{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		svcs, _ := c.informers[0].serviceLister.List(labels.Everything())
+		return len(svcs) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, w.reconcileSentries(ctx, 1024))
+	require.Same(t, sentry, w.reconciler.sentries["tcp://10.0.0.1:1234"])
+	require.True(t, sentry.removeAt.IsZero())
+
+	// Sentries whose pod is gone are removed right away.
+	require.NoError(t, client.CoreV1().Pods("default").Delete(ctx, "sentry-0", metav1.DeleteOptions{}))
+	require.Eventually(t, func() bool {
+		pods, _ := c.informers[0].podLister.List(labels.Everything())
+		return len(pods) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, w.reconcileSentries(ctx, 1024))
+	require.Empty(t, w.reconciler.sentries)
+}
+
+func TestSentryWatcherRemovalGraceShard(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset(sentryService("sentry", "default"))
+	for i := 0; i < 10; i++ {
+		pod := sentryPod(fmt.Sprintf("sentry-%d", i), "default", "sentry", "node-a", fmt.Sprintf("10.0.0.%d", i+1))
+		_, err := client.CoreV1().Pods("default").Create(ctx, pod, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	var clockMu sync.Mutex
+	now := time.Now()
+	clock := func() time.Time {
+		clockMu.Lock()
+		defer clockMu.Unlock()
+		return now
+	}
+	newCoordinator := func(identity string) *shardCoordinator {
+		s, err := newShardCoordinator(client, ShardOptions{
+			Group:         "validators",
+			Identity:      identity,
+			Namespace:     "default",
+			LeaseDuration: 15 * time.Second,
+		}, cometlog.NewNopLogger(), func() {})
+		require.NoError(t, err)
+		s.now = clock
+		return s
+	}
+
+	w := newTestWatcher()
+	w.reconciler.removalGrace = time.Hour
+	c := &kubeCluster{
+		all:      true,
+		selector: testSelector(),
+		log:      cometlog.NewNopLogger(),
+	}
+	w.addCluster(c)
+	require.NoError(t, c.setClient(client, []string{"default"}))
+	c.startInformers(w.stop)
+	t.Cleanup(func() {
+		close(w.stop)
+		_ = w.reconciler.stop()
+	})
+
+	w.shard = newCoordinator("proxy-0")
+	w.shard.start(ctx, w.stop)
+	require.NoError(t, w.reconcileSentries(ctx, 1024))
+	require.Len(t, w.reconciler.sentries, 10)
+
+	// A second replica joins, the sentries it now owns are removed right away
+	// despite the removal grace.
+	other := newCoordinator("proxy-1")
+	other.start(ctx, w.stop)
+	require.Eventually(t, func() bool {
+		peers, err := w.shard.livePeers()
+		return err == nil && len(peers) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	owns, err := w.shard.owners()
+	require.NoError(t, err)
+
+	require.NoError(t, w.reconcileSentries(ctx, 1024))
+	require.NotEmpty(t, w.reconciler.sentries)
+	require.Less(t, len(w.reconciler.sentries), 10)
+	for key, s := range w.reconciler.sentries {
+		require.True(t, owns(key), key)
+		require.True(t, s.removeAt.IsZero(), key)
+	}
+
+	// The lease of this replica lapses, all its sentries are removed right away.
+	clockMu.Lock()
+	now = now.Add(20 * time.Second)
+	clockMu.Unlock()
+	require.Error(t, w.reconcileSentries(ctx, 1024))
+	require.Empty(t, w.reconciler.sentries)
+}
+
+func TestSentryWatcherNamespaces(t *testing.T) {
+	tests := []struct {
+		name       string
+		namespaces []string
+		want       []string
+	}{
+		{
+			name:       "single namespace",
+			namespaces: []string{"chain-a"},
+			want:       []string{"tcp://10.0.0.1:1234"},
+		},
+		{
+			name:       "multiple namespaces",
+			namespaces: []string{"chain-a", "chain-b", "chain-a"},
+			want:       []string{"tcp://10.0.0.1:1234", "tcp://10.0.0.2:1234"},
+		},
+		{
+			name:       "all namespaces",
+			namespaces: []string{"chain-a", metav1.NamespaceAll},
+			want:       []string{"tcp://10.0.0.1:1234", "tcp://10.0.0.2:1234", "tcp://10.0.0.3:1234"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(
+				sentryService("sentry", "chain-a"), sentryPod("sentry-0", "chain-a", "sentry", "node-a", "10.0.0.1"),
+				sentryService("sentry", "chain-b"), sentryPod("sentry-0", "chain-b", "sentry", "node-a", "10.0.0.2"),
+				sentryService("sentry", "chain-c"), sentryPod("sentry-0", "chain-c", "sentry", "node-a", "10.0.0.3"),
+			)
+
+			w := newTestWatcher()
+			c := &kubeCluster{
+				all:      true,
+				selector: testSelector(),
+				log:      cometlog.NewNopLogger(),
+			}
+			w.addCluster(c)
+			require.NoError(t, c.setClient(client, tt.namespaces))
+			c.startInformers(w.stop)
+			t.Cleanup(func() {
+				close(w.stop)
+				_ = w.reconciler.stop()
+			})
+
+			require.NoError(t, w.reconcileSentries(context.Background(), 1024))
+
+			got := make([]string, 0, len(w.reconciler.sentries))
+			for addr := range w.reconciler.sentries {
+				got = append(got, addr)
+			}
+			require.ElementsMatch(t, tt.want, got)
+		})
+	}
+}
+
+func TestSentryWatcherMultiReplicaService(t *testing.T) {
+	svc := sentryService("sentry", "default")
+	svc.Spec.Ports[0].TargetPort = intstr.FromString("privval")
+
+	pod := func(name, node, ip string) *corev1.Pod {
+		p := sentryPod(name, "default", "sentry", node, ip)
+		p.Spec.Containers = []corev1.Container{{
+			Name:  "node",
+			Ports: []corev1.ContainerPort{{Name: "privval", ContainerPort: 1235}},
+		}}
+		return p
+	}
+
+	tests := []struct {
+		name string
+		all  bool
+		want []string
+	}{
+		{
+			name: "all nodes",
+			all:  true,
+			want: []string{"tcp://10.0.0.1:1235", "tcp://10.0.0.2:1235", "tcp://[fd00::3]:1235"},
+		},
+		{
+			name: "this node",
+			want: []string{"tcp://10.0.0.1:1235", "tcp://[fd00::3]:1235"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(
+				svc,
+				pod("sentry-0", "node-a", "10.0.0.1"),
+				pod("sentry-1", "node-b", "10.0.0.2"),
+				pod("sentry-2", "node-a", "fd00::3"),
+				pod("sentry-3", "node-a", ""), // not scheduled yet
+			)
+
+			w := newTestWatcher()
+			c := &kubeCluster{
+				all:      tt.all,
+				selector: testSelector(),
+				log:      cometlog.NewNopLogger(),
+				topology: topologySelector{node: "node-a"},
+			}
+			w.addCluster(c)
+			require.NoError(t, c.setClient(client, []string{"default"}))
+			c.startInformers(w.stop)
+			t.Cleanup(func() {
+				close(w.stop)
+				_ = w.reconciler.stop()
+			})
+
+			require.NoError(t, w.reconcileSentries(context.Background(), 1024))
+
+			got := make([]string, 0, len(w.reconciler.sentries))
+			for addr := range w.reconciler.sentries {
+				got = append(got, addr)
+			}
+			require.ElementsMatch(t, tt.want, got)
+		})
+	}
+}
+
+// failingPodLister fails to list the pods of one namespace.
+type failingPodLister struct {
+	corelisters.PodLister
+	namespace string
+}
+
+func (l failingPodLister) Pods(namespace string) corelisters.PodNamespaceLister {
+	if namespace == l.namespace {
+		return failingPodNamespaceLister{}
+	}
+	return l.PodLister.Pods(namespace)
+}
+
+type failingPodNamespaceLister struct {
+	corelisters.PodNamespaceLister
+}
+
+func (failingPodNamespaceLister) List(labels.Selector) ([]*corev1.Pod, error) {
+	return nil, errors.New("boom")
+}
+
+func TestSentryWatcherReconcileErrorIsolation(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		sentryService("sentry", "chain-a"), sentryPod("sentry-0", "chain-a", "sentry", "node-a", "10.0.0.1"),
+		sentryService("sentry", "chain-b"), sentryPod("sentry-0", "chain-b", "sentry", "node-a", "10.0.0.2"),
+	)
+
+	w := newTestWatcher()
+	c := &kubeCluster{
+		all:      true,
+		selector: testSelector(),
+		log:      cometlog.NewNopLogger(),
+	}
+	w.addCluster(c)
+	require.NoError(t, c.setClient(client, []string{metav1.NamespaceAll}))
+	c.startInformers(w.stop)
+	t.Cleanup(func() {
+		close(w.stop)
+		_ = w.reconciler.stop()
+	})
+
+	ctx := context.Background()
+
+	require.NoError(t, w.reconcileSentries(ctx, 1024))
+	require.Len(t, w.reconciler.sentries, 2)
+	require.NoError(t, w.LastReconcile().Err())
+	require.Equal(t, 2, w.LastReconcile().Sentries)
+
+	// Listing the pods of chain-a fails, and the chain-b sentry is gone.
+	podLister := c.informers[0].podLister
+	c.informers[0].podLister = failingPodLister{PodLister: podLister, namespace: "chain-a"}
+	require.NoError(t, client.CoreV1().Pods("chain-b").Delete(ctx, "sentry-0", metav1.DeleteOptions{}))
+	require.Eventually(t, func() bool {
+		pods, _ := podLister.Pods("chain-b").List(labels.Everything())
+		return len(pods) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	err := w.reconcileSentries(ctx, 1024)
+	require.ErrorContains(t, err, "chain-a/sentry: failed to list pods")
+
+	// The chain-a sentry is kept, the chain-b sentry is removed.
+	require.Len(t, w.reconciler.sentries, 1)
+	require.Contains(t, w.reconciler.sentries, "tcp://10.0.0.1:1234")
+
+	result := w.LastReconcile()
+	require.Equal(t, 1, result.Sentries)
+	require.Contains(t, result.Errors, "chain-a/sentry")
+}
+
+func TestSentryWatcherAnnotations(t *testing.T) {
+	ignored := sentryService("ignored", "default")
+	ignored.Annotations = map[string]string{annotationIgnore: "true"}
+
+	client := fake.NewSimpleClientset(
+		sentryService("sentry", "default"), sentryPod("sentry-0", "default", "sentry", "node-a", "10.0.0.1"),
+		ignored, sentryPod("ignored-0", "default", "ignored", "node-a", "10.0.0.2"),
+	)
+
+	w := newTestWatcher()
+	c := &kubeCluster{
+		all:      true,
+		selector: testSelector(),
+		log:      cometlog.NewNopLogger(),
+	}
+	w.addCluster(c)
+	require.NoError(t, c.setClient(client, []string{"default"}))
+	c.startInformers(w.stop)
+	t.Cleanup(func() {
+		close(w.stop)
+		_ = w.reconciler.stop()
+	})
+
+	ctx := context.Background()
+	const address = "tcp://10.0.0.1:1234"
+
+	require.NoError(t, w.reconcileSentries(ctx, 1024))
+	require.Len(t, w.reconciler.sentries, 1)
+	require.Contains(t, w.reconciler.sentries, address)
+	original := w.reconciler.sentries[address].signer
+
+	annotate := func(annotations map[string]string) {
+		svc := sentryService("sentry", "default")
+		svc.Annotations = annotations
+		_, err := client.CoreV1().Services("default").Update(ctx, svc, metav1.UpdateOptions{})
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			svc, err := c.informers[0].serviceLister.Services("default").Get("sentry")
+			return err == nil && len(svc.Annotations) == len(annotations)
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	// A changed annotation reconnects the sentry with the new config.
+	annotate(map[string]string{annotationChainIDs: "chain-b, chain-a", annotationMaxReadSize: "2048"})
+	require.NoError(t, w.reconcileSentries(ctx, 1024))
+	require.Len(t, w.reconciler.sentries, 1)
+	reconfigured := w.reconciler.sentries[address]
+	require.NotSame(t, original, reconfigured.signer)
+	require.Equal(t, []string{"chain-a", "chain-b"}, reconfigured.endpoint.config.chainIDs)
+	require.Equal(t, 2048, reconfigured.endpoint.config.maxReadSize)
+
+	// An invalid annotation is reported and the sentry is kept as it is.
+	annotate(map[string]string{annotationDialTimeout: "soon"})
+	require.ErrorContains(t, w.reconcileSentries(ctx, 1024), "default/sentry: invalid "+annotationDialTimeout)
+	require.Same(t, reconfigured, w.reconciler.sentries[address])
+
+	// Opting out removes the sentry.
+	annotate(map[string]string{annotationIgnore: "true"})
+	require.NoError(t, w.reconcileSentries(ctx, 1024))
+	require.Empty(t, w.reconciler.sentries)
+}
+
+func TestServicePrivvalPort(t *testing.T) {
+	withPorts := func(annotations map[string]string, names ...string) *corev1.Service {
+		svc := sentryService("sentry", "default")
+		svc.Annotations = annotations
+		svc.Spec.Ports = nil
+		for i, name := range names {
+			svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{Name: name, Port: int32(1234 + i)})
+		}
+		return svc
+	}
+
+	tests := []struct {
+		name     string
+		service  *corev1.Service
+		wantPort int32
+		wantOK   bool
+		wantErr  string
+	}{
+		{name: "sentry-privval port", service: withPorts(nil, "sentry-privval"), wantPort: 1234, wantOK: true},
+		{name: "other port", service: withPorts(nil, "p2p")},
+		{name: "several ports", service: withPorts(nil, "sentry-privval", "p2p")},
+		{
+			name:     "annotated port",
+			service:  withPorts(map[string]string{annotationPortName: "privval"}, "p2p", "privval"),
+			wantPort: 1235,
+			wantOK:   true,
+		},
+		{
+			name:    "annotated port missing",
+			service: withPorts(map[string]string{annotationPortName: "privval"}, "sentry-privval"),
+			wantErr: `no port named "privval"`,
+		},
+		{
+			name:    "empty annotation",
+			service: withPorts(map[string]string{annotationPortName: " "}, "sentry-privval"),
+			wantErr: "invalid " + annotationPortName,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			port, ok, err := servicePrivvalPort(tt.service)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantOK, ok)
+			require.Equal(t, tt.wantPort, port.Port)
+		})
+	}
+}
+
+func TestSentryWatcherMultiCluster(t *testing.T) {
+	// Pod IPs overlap between the clusters.
+	localClient := fake.NewSimpleClientset(
+		sentryService("sentry", "default"), sentryPod("sentry-0", "default", "sentry", "node-a", "10.0.0.1"),
+	)
+	eastSentry := sentryService("sentry", "default")
+	eastSentry.Labels["region"] = "east"
+	eastClient := fake.NewSimpleClientset(
+		eastSentry, sentryPod("sentry-0", "default", "sentry", "node-a", "10.0.0.1"),
+		// not selected by the east cluster's labels
+		sentryService("other", "default"), sentryPod("other-0", "default", "other", "node-a", "10.0.0.2"),
+	)
+
+	w := newTestWatcher()
+	local := &kubeCluster{
+		all:      true,
+		selector: testSelector(),
+		log:      cometlog.NewNopLogger(),
+	}
+	east := &kubeCluster{
+		name:     "east",
+		all:      true,
+		selector: testSelector("region=east"),
+		log:      cometlog.NewNopLogger(),
+	}
+	w.addCluster(local)
+	w.addCluster(east)
+	require.NoError(t, local.setClient(localClient, []string{"default"}))
+	require.NoError(t, east.setClient(eastClient, []string{"default"}))
+
+	local.startInformers(w.stop)
+	t.Cleanup(func() {
+		close(w.stop)
+		_ = w.reconciler.stop()
+	})
+
+	ctx := context.Background()
+
+	// The east cluster has not synced yet.
+	err := w.reconcileSentries(ctx, 1024)
+	require.ErrorContains(t, err, "east/cluster: informers have not synced yet")
+	require.Len(t, w.reconciler.sentries, 1)
+	require.Contains(t, w.reconciler.sentries, "tcp://10.0.0.1:1234")
+
+	east.startInformers(w.stop)
+	require.NoError(t, w.reconcileSentries(ctx, 1024))
+	require.Len(t, w.reconciler.sentries, 2)
+	require.Contains(t, w.reconciler.sentries, "tcp://10.0.0.1:1234")
+	require.Contains(t, w.reconciler.sentries, "east/tcp://10.0.0.1:1234")
+	require.Equal(t, "east", w.reconciler.sentries["east/tcp://10.0.0.1:1234"].endpoint.cluster.name)
+
+	// Listing pods in the east cluster fails, its sentry is kept.
+	east.informers[0].podLister = failingPodLister{PodLister: east.informers[0].podLister, namespace: "default"}
+	require.ErrorContains(t, w.reconcileSentries(ctx, 1024), "east/default/sentry: failed to list pods")
+	require.Len(t, w.reconciler.sentries, 2)
+}
+
+func TestSentryWatcherReadyPods(t *testing.T) {
+	now := time.Now()
+
+	pending := sentryPod("pending-0", "default", "sentry", "node-a", "10.0.0.1")
+	pending.Status.Phase = corev1.PodPending
+
+	notReady := sentryPod("sentry-1", "default", "sentry", "node-a", "10.0.0.2")
+	notReady.Status.Conditions[0].Status = corev1.ConditionFalse
+
+	deleting := sentryPod("sentry-2", "default", "sentry", "node-a", "10.0.0.3")
+	deleting.DeletionTimestamp = &metav1.Time{Time: now}
+	deleting.Finalizers = []string{"test"}
+
+	justReady := sentryPod("sentry-3", "default", "sentry", "node-a", "10.0.0.4")
+	justReady.Status.Conditions[0].LastTransitionTime = metav1.NewTime(now.Add(-time.Second))
+
+	ready := sentryPod("sentry-4", "default", "sentry", "node-a", "10.0.0.5")
+	ready.Status.Conditions[0].LastTransitionTime = metav1.NewTime(now.Add(-time.Minute))
+
+	client := fake.NewSimpleClientset(sentryService("sentry", "default"), pending, notReady, deleting, justReady, ready)
+
+	w := newTestWatcher()
+	c := &kubeCluster{
+		all:      true,
+		selector: testSelector(),
+		log:      cometlog.NewNopLogger(),
+
+		readyGrace: 10 * time.Second,
+		now:        func() time.Time { return now },
+	}
+	w.addCluster(c)
+	require.NoError(t, c.setClient(client, []string{"default"}))
+	c.startInformers(w.stop)
+	t.Cleanup(func() {
+		close(w.stop)
+		_ = w.reconciler.stop()
+	})
+
+	ctx := context.Background()
+
+	require.NoError(t, w.reconcileSentries(ctx, 1024))
+	require.Len(t, w.reconciler.sentries, 1)
+	require.Contains(t, w.reconciler.sentries, "tcp://10.0.0.5:1234")
+
+	// A reconcile is scheduled for when the grace of the just Ready pod has passed.
+	require.NotNil(t, c.graceTimer)
+	require.Equal(t, now.Add(9*time.Second), c.graceAt)
+
+	now = now.Add(10 * time.Second)
+	require.NoError(t, w.reconcileSentries(ctx, 1024))
+	require.Len(t, w.reconciler.sentries, 2)
+	require.Contains(t, w.reconciler.sentries, "tcp://10.0.0.4:1234")
+
+	// The connection to a pod being deleted is torn down before it goes away.
+	ready.DeletionTimestamp = &metav1.Time{Time: now}
+	_, err := client.CoreV1().Pods("default").Update(ctx, ready, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		pod, err := c.informers[0].podLister.Pods("default").Get("sentry-4")
+		return err == nil && pod.DeletionTimestamp != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, w.reconcileSentries(ctx, 1024))
+	require.Len(t, w.reconciler.sentries, 1)
+	require.NotContains(t, w.reconciler.sentries, "tcp://10.0.0.5:1234")
+}
+
+// fakeSigners is a SignerFactory of fake remote signers that tracks which
+// sentries are connected to, without dialing them.
+type fakeSigners struct {
+	mu      sync.Mutex
+	running map[string]int
+	starts  map[string]int
+	failing map[string]bool
+}
+
+func newFakeSigners() *fakeSigners {
+	return &fakeSigners{running: make(map[string]int), starts: make(map[string]int), failing: make(map[string]bool)}
+}
+
+// setFailing makes the signers of the sentry at address fail to start.
+func (f *fakeSigners) setFailing(address string, failing bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failing[address] = failing
+}
+
+func (f *fakeSigners) factory(
+	address string,
+	_ cometlog.Logger,
+	_ signer.HorcruxConnection,
+	_ net.Dialer,
+	_ int,
+	_ ...signer.ReconnRemoteSignerOption,
+) RemoteSigner {
+	return &fakeSigner{address: address, signers: f}
+}
+
+// addresses returns the sorted addresses of the running signers.
+func (f *fakeSigners) addresses() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	addresses := make([]string, 0, len(f.running))
+	for address := range f.running {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// startCount returns how often a signer of the address was started.
+func (f *fakeSigners) startCount(address string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.starts[address]
+}
+
+type fakeSigner struct {
+	address string
+	signers *fakeSigners
+}
+
+func (s *fakeSigner) Start() error {
+	s.signers.mu.Lock()
+	defer s.signers.mu.Unlock()
+	if s.signers.failing[s.address] {
+		return errors.New("connection refused")
+	}
+	s.signers.running[s.address]++
+	s.signers.starts[s.address]++
+	return nil
+}
+
+func (s *fakeSigner) Stop() error {
+	s.signers.mu.Lock()
+	defer s.signers.mu.Unlock()
+	if s.signers.running[s.address]--; s.signers.running[s.address] <= 0 {
+		delete(s.signers.running, s.address)
+	}
+	return nil
+}
+
+func TestSentryWatcherReconcile(t *testing.T) {
+	withLabels := func(s *corev1.Service, labels map[string]string) *corev1.Service {
+		for k, v := range labels {
+			s.Labels[k] = v
+		}
+		return s
+	}
+	withPort := func(s *corev1.Service, name string) *corev1.Service {
+		s.Spec.Ports[0].Name = name
+		return s
+	}
+	notReady := func(p *corev1.Pod) *corev1.Pod {
+		p.Status.Conditions[0].Status = corev1.ConditionFalse
+		return p
+	}
+
+	tests := []struct {
+		name    string
+		all     bool
+		labels  []string
+		objects []runtime.Object
+		want    []string
+
+		// update changes the objects after the first reconcile, resulting in wantAfter.
+		update    func(ctx context.Context, client *fake.Clientset) error
+		wantAfter []string
+	}{
+		{
+			name: "sentry on this node",
+			objects: []runtime.Object{
+				sentryService("sentry", "default"),
+				sentryPod("sentry-0", "default", "sentry", "node-a", "10.0.0.1"),
+				sentryPod("sentry-1", "default", "sentry", "node-b", "10.0.0.2"),
+			},
+			want: []string{"tcp://10.0.0.1:1234"},
+		},
+		{
+			name: "sentries on all nodes",
+			all:  true,
+			objects: []runtime.Object{
+				sentryService("sentry", "default"),
+				sentryPod("sentry-0", "default", "sentry", "node-a", "10.0.0.1"),
+				sentryPod("sentry-1", "default", "sentry", "node-b", "10.0.0.2"),
+			},
+			want: []string{"tcp://10.0.0.1:1234", "tcp://10.0.0.2:1234"},
+		},
+		{
+			name: "service without sentry label",
+			objects: []runtime.Object{
+				&corev1.Service{
+					ObjectMeta: metav1.ObjectMeta{Name: "sentry", Namespace: "default"},
+					Spec:       sentryService("sentry", "default").Spec,
+				},
+				sentryPod("sentry-0", "default", "sentry", "node-a", "10.0.0.1"),
+			},
+			want: []string{},
+		},
+		{
+			name: "service without privval port",
+			objects: []runtime.Object{
+				withPort(sentryService("sentry", "default"), "p2p"),
+				sentryPod("sentry-0", "default", "sentry", "node-a", "10.0.0.1"),
+			},
+			want: []string{},
+		},
+		{
+			name:   "service selected by extra label",
+			labels: []string{"team=a"},
+			objects: []runtime.Object{
+				withLabels(sentryService("a", "default"), map[string]string{"team": "a"}),
+				sentryPod("a-0", "default", "a", "node-a", "10.0.0.1"),
+				withLabels(sentryService("b", "default"), map[string]string{"team": "b"}),
+				sentryPod("b-0", "default", "b", "node-a", "10.0.0.2"),
+			},
+			want: []string{"tcp://10.0.0.1:1234"},
+		},
+		{
+			name: "pod not ready or without ip",
+			objects: []runtime.Object{
+				sentryService("sentry", "default"),
+				notReady(sentryPod("sentry-0", "default", "sentry", "node-a", "10.0.0.1")),
+				sentryPod("sentry-1", "default", "sentry", "node-a", ""),
+				sentryPod("sentry-2", "default", "sentry", "node-a", "10.0.0.3"),
+			},
+			want: []string{"tcp://10.0.0.3:1234"},
+		},
+		{
+			name: "pod in another namespace",
+			objects: []runtime.Object{
+				sentryService("sentry", "other"),
+				sentryPod("sentry-0", "other", "sentry", "node-a", "10.0.0.1"),
+			},
+			want: []string{},
+		},
+		{
+			name:    "pod added",
+			objects: []runtime.Object{sentryService("sentry", "default")},
+			want:    []string{},
+			update: func(ctx context.Context, client *fake.Clientset) error {
+				_, err := client.CoreV1().Pods("default").Create(ctx,
+					sentryPod("sentry-0", "default", "sentry", "node-a", "10.0.0.1"), metav1.CreateOptions{})
+				return err
+			},
+			wantAfter: []string{"tcp://10.0.0.1:1234"},
+		},
+		{
+			name: "pod removed",
+			objects: []runtime.Object{
+				sentryService("sentry", "default"),
+				sentryPod("sentry-0", "default", "sentry", "node-a", "10.0.0.1"),
+				sentryPod("sentry-1", "default", "sentry", "node-a", "10.0.0.2"),
+			},
+			want: []string{"tcp://10.0.0.1:1234", "tcp://10.0.0.2:1234"},
+			update: func(ctx context.Context, client *fake.Clientset) error {
+				return client.CoreV1().Pods("default").Delete(ctx, "sentry-0", metav1.DeleteOptions{})
+			},
+			wantAfter: []string{"tcp://10.0.0.2:1234"},
+		},
+		{
+			name: "pod rescheduled with a new ip",
+			objects: []runtime.Object{
+				sentryService("sentry", "default"),
+				sentryPod("sentry-0", "default", "sentry", "node-a", "10.0.0.1"),
+			},
+			want: []string{"tcp://10.0.0.1:1234"},
+			update: func(ctx context.Context, client *fake.Clientset) error {
+				_, err := client.CoreV1().Pods("default").Update(ctx,
+					sentryPod("sentry-0", "default", "sentry", "node-a", "10.0.0.9"), metav1.UpdateOptions{})
+				return err
+			},
+			wantAfter: []string{"tcp://10.0.0.9:1234"},
+		},
+		{
+			name: "pod moved to another node",
+			objects: []runtime.Object{
+				sentryService("sentry", "default"),
+				sentryPod("sentry-0", "default", "sentry", "node-a", "10.0.0.1"),
+			},
+			want: []string{"tcp://10.0.0.1:1234"},
+			update: func(ctx context.Context, client *fake.Clientset) error {
+				_, err := client.CoreV1().Pods("default").Update(ctx,
+					sentryPod("sentry-0", "default", "sentry", "node-b", "10.0.0.1"), metav1.UpdateOptions{})
+				return err
+			},
+			wantAfter: []string{},
+		},
+		{
+			name: "service removed",
+			objects: []runtime.Object{
+				sentryService("sentry", "default"),
+				sentryPod("sentry-0", "default", "sentry", "node-a", "10.0.0.1"),
+			},
+			want: []string{"tcp://10.0.0.1:1234"},
+			update: func(ctx context.Context, client *fake.Clientset) error {
+				return client.CoreV1().Services("default").Delete(ctx, "sentry", metav1.DeleteOptions{})
+			},
+			wantAfter: []string{},
+		},
+		{
+			name: "service relabeled",
+			objects: []runtime.Object{
+				sentryService("sentry", "default"),
+				sentryPod("sentry-0", "default", "sentry", "node-a", "10.0.0.1"),
+			},
+			want: []string{"tcp://10.0.0.1:1234"},
+			update: func(ctx context.Context, client *fake.Clientset) error {
+				s := sentryService("sentry", "default")
+				s.Labels = map[string]string{"app.kubernetes.io/component": "cosmos-fullnode"}
+				_, err := client.CoreV1().Services("default").Update(ctx, s, metav1.UpdateOptions{})
+				return err
+			},
+			wantAfter: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			client := fake.NewSimpleClientset(tt.objects...)
+			signers := newFakeSigners()
+
+			kubeOpts := KubeOptions{
+				Client:     client,
+				Node:       "node-a",
+				Namespaces: []string{"default"},
+			}
+			w, err := NewSentryWatcher(ctx, tt.labels, cometlog.NewNopLogger(), tt.all, nil, true, kubeOpts, nil, 1024,
+				SentryWatcherSignerFactory(signers.factory))
+			require.NoError(t, err)
+
+			go w.Watch(ctx, 1024)
+			t.Cleanup(func() {
+				require.NoError(t, w.Stop())
+				require.Empty(t, signers.addresses())
+			})
+
+			require.Eventually(t, func() bool {
+				return !w.LastReconcile().Time.IsZero()
+			}, 5*time.Second, 10*time.Millisecond)
+			require.Equal(t, tt.want, signers.addresses())
+
+			if tt.update == nil {
+				return
+			}
+			require.NoError(t, tt.update(ctx, client))
+			require.Eventually(t, func() bool {
+				return equalStrings(tt.wantAfter, signers.addresses())
+			}, 5*time.Second, 10*time.Millisecond)
+		})
+	}
+}
@@ -33,3 +33,14 @@ type RemoteSignerError struct {
 func (e *RemoteSignerError) Error() string {
 	return fmt.Sprintf("signerEndpoint returned error #%d: %s", e.Code, e.Description)
 }
+
+// PeerRejectedError occurs when a unix socket peer does not pass the
+// peer credential checks of the listener.
+type PeerRejectedError struct {
+	Cred   PeerCredentials
+	Reason string
+}
+
+func (e *PeerRejectedError) Error() string {
+	return fmt.Sprintf("rejected unix socket peer (pid=%d uid=%d gid=%d): %s", e.Cred.PID, e.Cred.UID, e.Cred.GID, e.Reason)
+}
@@ -15,9 +15,16 @@ type RemoteSignerLoadBalancer struct {
 }
 
 func NewRemoteSignerLoadBalancer(logger cometlog.Logger, listeners []SignerListener) *RemoteSignerLoadBalancer {
-	ch := make(chan SignerListener, len(listeners))
+	// Each listener is available once for every connection in its pool.
+	size := 0
 	for i := range listeners {
-		ch <- listeners[i]
+		size += listeners[i].MaxConnections()
+	}
+	ch := make(chan SignerListener, size)
+	for i := range listeners {
+		for j := 0; j < listeners[i].MaxConnections(); j++ {
+			ch <- listeners[i]
+		}
 	}
 	return &RemoteSignerLoadBalancer{
 		logger:    logger,
@@ -35,6 +42,16 @@ func (lb *RemoteSignerLoadBalancer) SendRequest(request privvalproto.Message) (*
 	return lis.SendRequest(request)
 }
 
+// IsConnected reports whether any listener has a connection from a cosigner.
+func (lb *RemoteSignerLoadBalancer) IsConnected() bool {
+	for _, listener := range lb.listeners {
+		if listener.NumConnections() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func (lb *RemoteSignerLoadBalancer) Start() error {
 	for _, listener := range lb.listeners {
 		if err := listener.Start(); err != nil {
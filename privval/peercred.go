@@ -0,0 +1,9 @@
+package privval
+
+// PeerCredentials are the credentials of the process on the other end of a
+// unix socket connection.
+type PeerCredentials struct {
+	PID int32
+	UID uint32
+	GID uint32 // The primary group ID, supplementary groups are not included.
+}
@@ -0,0 +1,35 @@
+//go:build linux
+
+package privval
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerCredentials reads the SO_PEERCRED credentials of the connected peer.
+func peerCredentials(conn *net.UnixConn) (PeerCredentials, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return PeerCredentials{}, err
+	}
+
+	var (
+		ucred   *syscall.Ucred
+		sockErr error
+	)
+	if err := raw.Control(func(fd uintptr) {
+		ucred, sockErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return PeerCredentials{}, err
+	}
+	if sockErr != nil {
+		return PeerCredentials{}, sockErr
+	}
+
+	return PeerCredentials{
+		PID: ucred.Pid,
+		UID: ucred.Uid,
+		GID: ucred.Gid,
+	}, nil
+}
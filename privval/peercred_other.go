@@ -0,0 +1,14 @@
+//go:build !linux
+
+package privval
+
+import (
+	"errors"
+	"net"
+)
+
+// peerCredentials is not supported on this platform, so any listener with a
+// peer allowlist will reject all connections.
+func peerCredentials(_ *net.UnixConn) (PeerCredentials, error) {
+	return PeerCredentials{}, errors.New("peer credentials are not supported on this platform")
+}
@@ -5,8 +5,8 @@ import (
 	"net"
 	"time"
 
+	"github.com/cometbft/cometbft/libs/log"
 	"github.com/cometbft/cometbft/libs/protoio"
-	"github.com/cometbft/cometbft/libs/service"
 	cmtsync "github.com/cometbft/cometbft/libs/sync"
 	privvalproto "github.com/cometbft/cometbft/proto/tendermint/privval"
 )
@@ -16,7 +16,7 @@ const (
 )
 
 type signerEndpoint struct {
-	service.BaseService
+	logger log.Logger
 
 	connMtx cmtsync.Mutex
 	conn    net.Conn
@@ -37,34 +37,6 @@ func (se *signerEndpoint) IsConnected() bool {
 	return se.isConnected()
 }
 
-// TryGetConnection retrieves a connection if it is already available
-func (se *signerEndpoint) GetAvailableConnection(connectionAvailableCh chan net.Conn) bool {
-	se.connMtx.Lock()
-	defer se.connMtx.Unlock()
-
-	// Is there a connection ready?
-	select {
-	case se.conn = <-connectionAvailableCh:
-		return true
-	default:
-	}
-	return false
-}
-
-// TryGetConnection retrieves a connection if it is already available
-func (se *signerEndpoint) WaitConnection(connectionAvailableCh chan net.Conn, maxWait time.Duration) error {
-	se.connMtx.Lock()
-	defer se.connMtx.Unlock()
-
-	select {
-	case se.conn = <-connectionAvailableCh:
-	case <-time.After(maxWait):
-		return ErrConnectionTimeout
-	}
-
-	return nil
-}
-
 // SetConnection replaces the current connection object
 func (se *signerEndpoint) SetConnection(newConnection net.Conn) {
 	se.connMtx.Lock()
@@ -104,7 +76,7 @@ func (se *signerEndpoint) ReadMessage() (msg privvalproto.Message, err error) {
 			err = fmt.Errorf("empty error: %w", ErrReadTimeout)
 		}
 
-		se.Logger.Debug("Dropping [read]", "obj", se)
+		se.logger.Debug("Dropping [read]", "obj", se)
 		se.dropConnection()
 	}
 
@@ -149,7 +121,7 @@ func (se *signerEndpoint) isConnected() bool {
 func (se *signerEndpoint) dropConnection() {
 	if se.conn != nil {
 		if err := se.conn.Close(); err != nil {
-			se.Logger.Error("signerEndpoint::dropConnection", "err", err)
+			se.logger.Error("signerEndpoint::dropConnection", "err", err)
 		}
 		se.conn = nil
 	}
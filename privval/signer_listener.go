@@ -2,21 +2,67 @@ package privval
 
 import (
 	"net"
+	"os"
 
 	"github.com/cometbft/cometbft/crypto/ed25519"
 	cometlog "github.com/cometbft/cometbft/libs/log"
 	cometnet "github.com/cometbft/cometbft/libs/net"
 )
 
+// DefaultUnixSocketMode is the file mode applied to unix sockets created by
+// NewSignerListener unless overridden with SignerListenerUnixSocketMode.
+const DefaultUnixSocketMode os.FileMode = 0660
+
+// SignerListenerOption sets an optional parameter on the SignerListener.
+type SignerListenerOption func(*signerListenerOptions)
+
+type signerListenerOptions struct {
+	unixSocketMode  os.FileMode
+	unixOptions     []UnixListenerOption
+	endpointOptions []SignerListenerEndpointOption
+}
+
+// SignerListenerUnixSocketMode sets the file mode of the unix socket when
+// listening on a unix address. It has no effect for tcp addresses.
+func SignerListenerUnixSocketMode(mode os.FileMode) SignerListenerOption {
+	return func(o *signerListenerOptions) { o.unixSocketMode = mode }
+}
+
+// SignerListenerUnixOptions sets the options applied to the UnixListener when
+// listening on a unix address. It has no effect for tcp addresses.
+func SignerListenerUnixOptions(options ...UnixListenerOption) SignerListenerOption {
+	return func(o *signerListenerOptions) { o.unixOptions = append(o.unixOptions, options...) }
+}
+
+// SignerListenerEndpointOptions sets the options applied to the
+// SignerListenerEndpoint, e.g. the size of its connection pool.
+func SignerListenerEndpointOptions(options ...SignerListenerEndpointOption) SignerListenerOption {
+	return func(o *signerListenerOptions) { o.endpointOptions = append(o.endpointOptions, options...) }
+}
+
 type SignerListener struct {
 	address string
 	*SignerListenerEndpoint
 }
 
-func NewSignerListener(logger cometlog.Logger, address string) SignerListener {
+func NewSignerListener(logger cometlog.Logger, address string, options ...SignerListenerOption) SignerListener {
+	opts := signerListenerOptions{
+		unixSocketMode: DefaultUnixSocketMode,
+	}
+	for _, optionFunc := range options {
+		optionFunc(&opts)
+	}
+
 	proto, address := cometnet.ProtocolAndAddress(address)
 
-	ln, err := net.Listen(proto, address)
+	var ln net.Listener
+	var err error
+	if proto == "unix" {
+		// The socket file is restricted before any connection can be made.
+		ln, err = ListenUnix(address, opts.unixSocketMode)
+	} else {
+		ln, err = net.Listen(proto, address)
+	}
 	logger.Info("SignerListener: Listening", "proto", proto, "address", address)
 	if err != nil {
 		panic(err)
@@ -25,7 +71,7 @@ func NewSignerListener(logger cometlog.Logger, address string) SignerListener {
 	var listener net.Listener
 
 	if proto == "unix" {
-		unixLn := NewUnixListener(ln)
+		unixLn := NewUnixListener(ln, opts.unixOptions...)
 		listener = unixLn
 	} else {
 		tcpLn := NewTCPListener(ln, ed25519.GenPrivKey())
@@ -34,6 +80,6 @@ func NewSignerListener(logger cometlog.Logger, address string) SignerListener {
 
 	return SignerListener{
 		address:                address,
-		SignerListenerEndpoint: NewSignerListenerEndpoint(logger, listener),
+		SignerListenerEndpoint: NewSignerListenerEndpoint(logger, listener, opts.endpointOptions...),
 	}
 }
@@ -1,8 +1,11 @@
 package privval
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cometbft/cometbft/libs/log"
@@ -11,6 +14,13 @@ import (
 	privvalproto "github.com/cometbft/cometbft/proto/tendermint/privval"
 )
 
+const (
+	// minAcceptBackoff and maxAcceptBackoff bound the delay before accepting
+	// again after an accept error.
+	minAcceptBackoff = 5 * time.Millisecond
+	maxAcceptBackoff = time.Second
+)
+
 // SignerListenerEndpointOption sets an optional parameter on the SignerListenerEndpoint.
 type SignerListenerEndpointOption func(*SignerListenerEndpoint)
 
@@ -19,26 +29,37 @@ type SignerListenerEndpointOption func(*SignerListenerEndpoint)
 //
 // Default: 5s
 func SignerListenerEndpointTimeoutReadWrite(timeout time.Duration) SignerListenerEndpointOption {
-	return func(sl *SignerListenerEndpoint) { sl.signerEndpoint.timeoutReadWrite = timeout }
+	return func(sl *SignerListenerEndpoint) { sl.timeoutReadWrite = timeout }
 }
 
-// SignerListenerEndpoint listens for an external process to dial in and keeps
-// the connection alive by dropping and reconnecting.
+// SignerListenerEndpointMaxConnections sets the maximum number of concurrent
+// connections from external signing processes that are kept in the pool.
 //
-// The process will send pings every ~3s (read/write timeout * 2/3) to keep the
-// connection alive.
+// Default: 1
+func SignerListenerEndpointMaxConnections(n int) SignerListenerEndpointOption {
+	return func(sl *SignerListenerEndpoint) { sl.maxConnections = n }
+}
+
+// SignerListenerEndpoint listens for external processes to dial in and keeps
+// a pool of up to maxConnections connections alive by dropping broken
+// connections and accepting new ones in their place.
+//
+// Requests are spread across the idle connections of the pool. Every
+// connection sends its own pings every ~3s (read/write timeout * 2/3) to keep
+// it alive.
 type SignerListenerEndpoint struct {
-	signerEndpoint
+	service.BaseService
 
-	listener              net.Listener
-	connectRequestCh      chan struct{}
-	connectionAvailableCh chan net.Conn
+	listener net.Listener
 
-	timeoutAccept time.Duration
-	pingTimer     *time.Ticker
-	pingInterval  time.Duration
+	timeoutAccept    time.Duration
+	timeoutReadWrite time.Duration
+	pingInterval     time.Duration
+	maxConnections   int
 
-	mu cmtsync.Mutex // Ensures instance public methods access, i.e. SendRequest
+	slots chan struct{}    // One token for every connection that may still be accepted.
+	idle  chan *signerConn // Connections that are ready to accept requests.
+	conns atomic.Int32     // Live connections, accepted and not yet closed.
 }
 
 // NewSignerListenerEndpoint returns an instance of SignerListenerEndpoint.
@@ -48,106 +69,127 @@ func NewSignerListenerEndpoint(
 	options ...SignerListenerEndpointOption,
 ) *SignerListenerEndpoint {
 	sl := &SignerListenerEndpoint{
-		listener:      listener,
-		timeoutAccept: defaultTimeoutAcceptSeconds * time.Second,
+		listener:         listener,
+		timeoutAccept:    defaultTimeoutAcceptSeconds * time.Second,
+		timeoutReadWrite: defaultTimeoutReadWriteSeconds * time.Second,
+		maxConnections:   1,
 	}
 
 	sl.BaseService = *service.NewBaseService(logger, "SignerListenerEndpoint", sl)
-	sl.signerEndpoint.timeoutReadWrite = defaultTimeoutReadWriteSeconds * time.Second
 
 	for _, optionFunc := range options {
 		optionFunc(sl)
 	}
 
+	if sl.maxConnections < 1 {
+		sl.maxConnections = 1
+	}
+
 	return sl
 }
 
+// MaxConnections returns the size of the connection pool.
+func (sl *SignerListenerEndpoint) MaxConnections() int {
+	return sl.maxConnections
+}
+
+// NumConnections returns the number of live connections in the pool.
+func (sl *SignerListenerEndpoint) NumConnections() int {
+	return int(sl.conns.Load())
+}
+
 // OnStart implements service.Service.
 func (sl *SignerListenerEndpoint) OnStart() error {
-	sl.connectRequestCh = make(chan struct{})
-	sl.connectionAvailableCh = make(chan net.Conn)
+	sl.slots = make(chan struct{}, sl.maxConnections)
+	for i := 0; i < sl.maxConnections; i++ {
+		sl.slots <- struct{}{}
+	}
+	sl.idle = make(chan *signerConn, sl.maxConnections)
 
 	// NOTE: ping timeout must be less than read/write timeout
-	sl.pingInterval = time.Duration(sl.signerEndpoint.timeoutReadWrite.Milliseconds()*2/3) * time.Millisecond
-	sl.pingTimer = time.NewTicker(sl.pingInterval)
+	sl.pingInterval = time.Duration(sl.timeoutReadWrite.Milliseconds()*2/3) * time.Millisecond
 
 	go sl.serviceLoop()
-	go sl.pingLoop()
-
-	sl.connectRequestCh <- struct{}{}
 
 	return nil
 }
 
 // OnStop implements service.Service
 func (sl *SignerListenerEndpoint) OnStop() {
-	sl.mu.Lock()
-	defer sl.mu.Unlock()
-	_ = sl.Close()
-
-	// Stop listening
+	// Stop listening. Pooled connections are closed by their ping loops.
 	if sl.listener != nil {
 		if err := sl.listener.Close(); err != nil {
 			sl.Logger.Error("Closing Listener", "err", err)
-			sl.listener = nil
 		}
 	}
-
-	sl.pingTimer.Stop()
 }
 
 // WaitForConnection waits maxWait for a connection or returns a timeout error
 func (sl *SignerListenerEndpoint) WaitForConnection(maxWait time.Duration) error {
-	sl.mu.Lock()
-	defer sl.mu.Unlock()
-	return sl.ensureConnection(maxWait)
-}
-
-// SendRequest ensures there is a connection, sends a request and waits for a response
-func (sl *SignerListenerEndpoint) SendRequest(request privvalproto.Message) (*privvalproto.Message, error) {
-	sl.mu.Lock()
-	defer sl.mu.Unlock()
-
-	err := sl.ensureConnection(sl.timeoutAccept)
+	c, err := sl.acquire(maxWait)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	sl.idle <- c
+	return nil
+}
 
-	err = sl.WriteMessage(request)
+// SendRequest waits for an idle connection in the pool, sends a request and
+// waits for a response. Connections that fail are dropped from the pool.
+func (sl *SignerListenerEndpoint) SendRequest(request privvalproto.Message) (*privvalproto.Message, error) {
+	c, err := sl.acquire(sl.timeoutAccept)
 	if err != nil {
 		return nil, err
 	}
 
-	res, err := sl.ReadMessage()
+	res, err := c.sendRequest(request)
 	if err != nil {
+		c.close()
 		return nil, err
 	}
 
-	// Reset pingTimer to avoid sending unnecessary pings.
-	sl.pingTimer.Reset(sl.pingInterval)
+	sl.idle <- c
 
-	return &res, nil
+	return res, nil
 }
 
-func (sl *SignerListenerEndpoint) ensureConnection(maxWait time.Duration) error {
-	if sl.IsConnected() {
-		return nil
+// acquire takes an idle connection from the pool, blocking for up to maxWait.
+func (sl *SignerListenerEndpoint) acquire(maxWait time.Duration) (*signerConn, error) {
+	if !sl.IsRunning() {
+		return nil, fmt.Errorf("endpoint is not running: %w", ErrNoConnection)
 	}
 
-	// Is there a connection ready? then use it
-	if sl.GetAvailableConnection(sl.connectionAvailableCh) {
-		return nil
-	}
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
 
-	// block until connected or timeout
-	sl.Logger.Info("SignerListener: Blocking for connection")
-	sl.triggerConnect()
-	err := sl.WaitConnection(sl.connectionAvailableCh, maxWait)
-	if err != nil {
-		return err
-	}
+	blocking := false
+	for {
+		select {
+		case c := <-sl.idle:
+			if c.isClosed() {
+				continue
+			}
+			return c, nil
+		default:
+		}
 
-	return nil
+		if !blocking {
+			sl.Logger.Info("SignerListener: Blocking for connection")
+			blocking = true
+		}
+
+		select {
+		case c := <-sl.idle:
+			if c.isClosed() {
+				continue
+			}
+			return c, nil
+		case <-timer.C:
+			return nil, ErrConnectionTimeout
+		case <-sl.Quit():
+			return nil, fmt.Errorf("endpoint is closing: %w", ErrNoConnection)
+		}
+	}
 }
 
 func (sl *SignerListenerEndpoint) acceptNewConnection() (net.Conn, error) {
@@ -159,63 +201,166 @@ func (sl *SignerListenerEndpoint) acceptNewConnection() (net.Conn, error) {
 	sl.Logger.Info("SignerListener: Listening for new connection")
 	conn, err := sl.listener.Accept()
 	if err != nil {
+		var rejected *PeerRejectedError
+		if errors.As(err, &rejected) {
+			sl.Logger.Error("SignerListener: Rejected connection", "err", err)
+		}
 		return nil, err
 	}
 
 	return conn, nil
 }
 
-func (sl *SignerListenerEndpoint) triggerConnect() {
-	select {
-	case sl.connectRequestCh <- struct{}{}:
-	default:
-	}
-}
+// serviceLoop accepts a new connection whenever the pool has a free slot.
+func (sl *SignerListenerEndpoint) serviceLoop() {
+	for {
+		select {
+		case <-sl.slots:
+		case <-sl.Quit():
+			return
+		}
 
-func (sl *SignerListenerEndpoint) triggerReconnect() {
-	sl.DropConnection()
-	sl.triggerConnect()
+		conn, ok := sl.acceptWithBackoff()
+		if !ok {
+			return
+		}
+
+		c := newSignerConn(sl, conn)
+		sl.conns.Add(1)
+		sl.Logger.Info("SignerListener: Connected", "connections", sl.NumConnections())
+
+		go c.pingLoop()
+		sl.idle <- c
+	}
 }
 
-func (sl *SignerListenerEndpoint) serviceLoop() {
+// acceptWithBackoff accepts a new connection, retrying until one is accepted
+// or the endpoint quits, in which case it returns false. Accept timeouts are
+// retried right away. Other errors, e.g. running out of file descriptors or
+// rejected peers, are retried with an exponential backoff like net/http does,
+// so they do not spin.
+func (sl *SignerListenerEndpoint) acceptWithBackoff() (net.Conn, bool) {
+	var delay time.Duration
 	for {
 		select {
-		case <-sl.connectRequestCh:
-			{
-				conn, err := sl.acceptNewConnection()
-				if err == nil {
-					sl.Logger.Info("SignerListener: Connected")
-
-					// We have a good connection, wait for someone that needs one otherwise cancellation
-					select {
-					case sl.connectionAvailableCh <- conn:
-					case <-sl.Quit():
-						return
-					}
-				}
-
-				select {
-				case sl.connectRequestCh <- struct{}{}:
-				default:
-				}
-			}
 		case <-sl.Quit():
-			return
+			return nil, false
+		default:
+		}
+
+		conn, err := sl.acceptNewConnection()
+		if err == nil {
+			return conn, true
+		}
+
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			delay = 0
+			continue
+		}
+
+		if delay == 0 {
+			delay = minAcceptBackoff
+		} else if delay *= 2; delay > maxAcceptBackoff {
+			delay = maxAcceptBackoff
+		}
+		// Rejected peers are logged by acceptNewConnection, and a stopping
+		// endpoint fails to accept on its closed listener.
+		var rejected *PeerRejectedError
+		if !errors.As(err, &rejected) && sl.IsRunning() {
+			sl.Logger.Error("SignerListener: Failed to accept connection", "err", err, "retry_in", delay)
 		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-sl.Quit():
+			timer.Stop()
+			return nil, false
+		case <-timer.C:
+		}
+	}
+}
+
+// signerConn is a single pooled connection of a SignerListenerEndpoint. It
+// keeps itself alive with its own pings.
+type signerConn struct {
+	signerEndpoint
+
+	sl *SignerListenerEndpoint
+
+	mu        cmtsync.Mutex // Serializes requests and pings on the connection.
+	pingTimer *time.Ticker
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newSignerConn(sl *SignerListenerEndpoint, conn net.Conn) *signerConn {
+	c := &signerConn{
+		sl:        sl,
+		pingTimer: time.NewTicker(sl.pingInterval),
+		closed:    make(chan struct{}),
+	}
+	c.signerEndpoint.logger = sl.Logger
+	c.signerEndpoint.timeoutReadWrite = sl.timeoutReadWrite
+	c.SetConnection(conn)
+	return c
+}
+
+func (c *signerConn) sendRequest(request privvalproto.Message) (*privvalproto.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.WriteMessage(request); err != nil {
+		return nil, err
+	}
+
+	res, err := c.ReadMessage()
+	if err != nil {
+		return nil, err
 	}
+
+	// Reset pingTimer to avoid sending unnecessary pings.
+	c.pingTimer.Reset(c.sl.pingInterval)
+
+	return &res, nil
 }
 
-func (sl *SignerListenerEndpoint) pingLoop() {
+func (c *signerConn) pingLoop() {
+	defer c.pingTimer.Stop()
 	for {
 		select {
-		case <-sl.pingTimer.C:
-			_, err := sl.SendRequest(mustWrapMsg(&privvalproto.PingRequest{}))
-			if err != nil {
-				sl.Logger.Error("SignerListener: Ping timeout")
-				sl.triggerReconnect()
+		case <-c.pingTimer.C:
+			if _, err := c.sendRequest(mustWrapMsg(&privvalproto.PingRequest{})); err != nil {
+				c.sl.Logger.Error("SignerListener: Ping timeout", "err", err)
+				c.close()
+				return
 			}
-		case <-sl.Quit():
+		case <-c.closed:
+			return
+		case <-c.sl.Quit():
+			c.close()
 			return
 		}
 	}
 }
+
+// close drops the connection and frees its slot in the pool so that a new
+// connection can be accepted.
+func (c *signerConn) close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.DropConnection()
+		c.sl.conns.Add(-1)
+		c.sl.slots <- struct{}{}
+	})
+}
+
+func (c *signerConn) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
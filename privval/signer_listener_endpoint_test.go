@@ -0,0 +1,141 @@
+package privval_test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cometbft/cometbft/libs/log"
+	cometprotoprivval "github.com/cometbft/cometbft/proto/tendermint/privval"
+	cometproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/strangelove-ventures/horcrux-proxy/privval"
+)
+
+func TestSignerListenerConnectionPool(t *testing.T) {
+	const (
+		listenAddr = "tcp://127.0.0.1:37331"
+		numSigners = 3
+	)
+
+	logger := log.NewTMJSONLogger(io.Discard)
+
+	listener := privval.NewSignerListener(logger, listenAddr, privval.SignerListenerEndpointOptions(
+		privval.SignerListenerEndpointMaxConnections(numSigners),
+	))
+
+	lb := privval.NewRemoteSignerLoadBalancer(logger, []privval.SignerListener{listener})
+
+	t.Cleanup(func() {
+		_ = lb.Stop()
+	})
+
+	require.NoError(t, lb.Start())
+
+	// A listener that is waiting for its first cosigner has no connection.
+	time.Sleep(100 * time.Millisecond)
+	require.Zero(t, listener.NumConnections())
+	require.False(t, lb.IsConnected())
+
+	remoteSigners := make([]*MockRemoteSigner, numSigners)
+
+	for i := range remoteSigners {
+		dialer := net.Dialer{Timeout: 2 * time.Second}
+		s := NewMockRemoteSigner(listenAddr, logger, dialer)
+
+		remoteSigners[i] = s
+
+		require.NoError(t, s.Start())
+		t.Cleanup(func() {
+			_ = s.Stop()
+		})
+
+		want := i + 1
+		require.Eventually(t, func() bool {
+			return listener.NumConnections() == want
+		}, 10*time.Second, 50*time.Millisecond)
+		require.True(t, lb.IsConnected())
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, numSigners, listener.NumConnections(), "the pool is full")
+
+	var eg errgroup.Group
+
+	for i := 0; i < 3000; i++ {
+		eg.Go(func() error {
+			_, err := lb.SendRequest(cometprotoprivval.Message{
+				Sum: &cometprotoprivval.Message_SignVoteRequest{SignVoteRequest: &cometprotoprivval.SignVoteRequest{
+					Vote: &cometproto.Vote{},
+				}},
+			})
+			return err
+		})
+	}
+
+	require.NoError(t, eg.Wait())
+
+	total := 0
+	for _, remoteSigner := range remoteSigners {
+		c := remoteSigner.Counter()
+		require.Greater(t, c.SignVoteRequests, 0)
+		total += c.SignVoteRequests
+	}
+
+	require.Equal(t, 3000, total)
+
+	// Closed connections are no longer counted.
+	for _, remoteSigner := range remoteSigners {
+		require.NoError(t, remoteSigner.Stop())
+	}
+	require.Eventually(t, func() bool {
+		return listener.NumConnections() == 0
+	}, 10*time.Second, 50*time.Millisecond)
+	require.False(t, lb.IsConnected())
+}
+
+// failingListener fails every Accept, like a listener out of file descriptors.
+type failingListener struct {
+	net.Listener
+	accepts atomic.Int32
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	l.accepts.Add(1)
+	return nil, errors.New("accept: too many open files")
+}
+
+func (l *failingListener) Close() error {
+	return nil
+}
+
+func TestSignerListenerAcceptBackoff(t *testing.T) {
+	listener := &failingListener{}
+	endpoint := privval.NewSignerListenerEndpoint(log.NewNopLogger(), listener)
+	require.NoError(t, endpoint.Start())
+
+	time.Sleep(300 * time.Millisecond)
+	accepts := listener.accepts.Load()
+	require.Greater(t, accepts, int32(1), "accept is retried")
+	require.Less(t, accepts, int32(20), "accept errors are retried with a backoff")
+
+	stopped := make(chan error)
+	go func() { stopped <- endpoint.Stop() }()
+	select {
+	case err := <-stopped:
+		require.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("endpoint did not stop")
+	}
+
+	// The accept loop quits with the endpoint.
+	time.Sleep(100 * time.Millisecond)
+	accepts = listener.accepts.Load()
+	time.Sleep(300 * time.Millisecond)
+	require.Equal(t, accepts, listener.accepts.Load())
+}
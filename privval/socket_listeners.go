@@ -1,6 +1,7 @@
 package privval
 
 import (
+	"fmt"
 	"net"
 	"time"
 
@@ -104,23 +105,61 @@ func UnixListenerTimeoutReadWrite(timeout time.Duration) UnixListenerOption {
 	return func(ul *UnixListener) { ul.timeoutReadWrite = timeout }
 }
 
+// UnixListenerAllowedUIDs restricts connections to peers running as one of
+// the given user IDs. An empty list places no restriction on the user ID.
+func UnixListenerAllowedUIDs(uids ...uint32) UnixListenerOption {
+	return func(ul *UnixListener) {
+		for _, uid := range uids {
+			ul.allowedUIDs[uid] = struct{}{}
+		}
+	}
+}
+
+// UnixListenerAllowedGIDs restricts connections to peers running as one of
+// the given group IDs. An empty list places no restriction on the group ID.
+//
+// Only the primary group ID of the peer is checked, SO_PEERCRED does not
+// carry its supplementary groups.
+func UnixListenerAllowedGIDs(gids ...uint32) UnixListenerOption {
+	return func(ul *UnixListener) {
+		for _, gid := range gids {
+			ul.allowedGIDs[gid] = struct{}{}
+		}
+	}
+}
+
 // UnixListener wraps a *net.UnixListener to standardize protocol timeouts
 // and potentially other tuning parameters. It returns unencrypted connections.
+//
+// If an allowlist of user or group IDs is configured, the peer credentials
+// (SO_PEERCRED) of each incoming connection are checked against it and
+// connections from other processes are rejected.
 type UnixListener struct {
 	*net.UnixListener
 
 	timeoutAccept    time.Duration
 	timeoutReadWrite time.Duration
+
+	allowedUIDs map[uint32]struct{}
+	allowedGIDs map[uint32]struct{}
 }
 
 // NewUnixListener returns a listener that accepts unencrypted connections
 // using the default timeout values.
-func NewUnixListener(ln net.Listener) *UnixListener {
-	return &UnixListener{
+func NewUnixListener(ln net.Listener, options ...UnixListenerOption) *UnixListener {
+	ul := &UnixListener{
 		UnixListener:     ln.(*net.UnixListener),
 		timeoutAccept:    time.Second * defaultTimeoutAcceptSeconds,
 		timeoutReadWrite: time.Second * defaultTimeoutReadWriteSeconds,
+		allowedUIDs:      make(map[uint32]struct{}),
+		allowedGIDs:      make(map[uint32]struct{}),
 	}
+
+	for _, optionFunc := range options {
+		optionFunc(ul)
+	}
+
+	return ul
 }
 
 // Accept implements net.Listener.
@@ -136,15 +175,44 @@ func (ln *UnixListener) Accept() (net.Conn, error) {
 		return nil, err
 	}
 
+	if err := ln.authenticate(tc); err != nil {
+		_ = tc.Close()
+		return nil, err
+	}
+
 	// Wrap the conn in our timeout wrapper
 	conn := newTimeoutConn(tc, ln.timeoutReadWrite)
 
-	// TODO: wrap in something that authenticates
-	// with a MAC - https://github.com/tendermint/tendermint/issues/3099
-
 	return conn, nil
 }
 
+// authenticate checks the peer credentials of the connection against the
+// configured allowlists.
+func (ln *UnixListener) authenticate(conn *net.UnixConn) error {
+	if len(ln.allowedUIDs) == 0 && len(ln.allowedGIDs) == 0 {
+		return nil
+	}
+
+	cred, err := peerCredentials(conn)
+	if err != nil {
+		return &PeerRejectedError{Reason: fmt.Sprintf("failed to read peer credentials: %v", err)}
+	}
+
+	if len(ln.allowedUIDs) > 0 {
+		if _, ok := ln.allowedUIDs[cred.UID]; !ok {
+			return &PeerRejectedError{Cred: cred, Reason: "uid not allowed"}
+		}
+	}
+
+	if len(ln.allowedGIDs) > 0 {
+		if _, ok := ln.allowedGIDs[cred.GID]; !ok {
+			return &PeerRejectedError{Cred: cred, Reason: "gid not allowed"}
+		}
+	}
+
+	return nil
+}
+
 //------------------------------------------------------------------
 // Connection
 
@@ -0,0 +1,94 @@
+package privval_test
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/cometbft/cometbft/libs/log"
+	"github.com/stretchr/testify/require"
+
+	"github.com/strangelove-ventures/horcrux-proxy/privval"
+)
+
+func TestUnixListenerPeerCredentials(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are only supported on linux")
+	}
+
+	uid := uint32(os.Getuid())
+
+	tests := []struct {
+		name    string
+		options []privval.UnixListenerOption
+		allowed bool
+	}{
+		{name: "no allowlist", allowed: true},
+		{name: "uid allowed", options: []privval.UnixListenerOption{privval.UnixListenerAllowedUIDs(uid)}, allowed: true},
+		{name: "uid not allowed", options: []privval.UnixListenerOption{privval.UnixListenerAllowedUIDs(uid + 1)}},
+		{name: "gid not allowed", options: []privval.UnixListenerOption{privval.UnixListenerAllowedGIDs(uint32(os.Getgid()) + 1)}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			addr := filepath.Join(t.TempDir(), "privval.sock")
+
+			ln, err := net.Listen("unix", addr)
+			require.NoError(t, err)
+
+			unixLn := privval.NewUnixListener(ln, tt.options...)
+			t.Cleanup(func() { _ = unixLn.Close() })
+
+			go func() {
+				conn, err := net.Dial("unix", addr)
+				if err == nil {
+					_ = conn.Close()
+				}
+			}()
+
+			conn, err := unixLn.Accept()
+			if tt.allowed {
+				require.NoError(t, err)
+				require.NoError(t, conn.Close())
+				return
+			}
+
+			var rejected *privval.PeerRejectedError
+			require.True(t, errors.As(err, &rejected))
+			require.Equal(t, uid, rejected.Cred.UID)
+		})
+	}
+}
+
+func TestSignerListenerUnixSocketMode(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "privval.sock")
+
+	lis := privval.NewSignerListener(log.NewNopLogger(), "unix://"+addr, privval.SignerListenerUnixSocketMode(0600))
+	require.NoError(t, lis.Start())
+	t.Cleanup(func() { _ = lis.Stop() })
+
+	fi, err := os.Stat(addr)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+}
+
+func TestListenUnix(t *testing.T) {
+	for _, mode := range []os.FileMode{0600, 0660, 0666} {
+		addr := filepath.Join(t.TempDir(), "privval.sock")
+
+		ln, err := privval.ListenUnix(addr, mode)
+		require.NoError(t, err)
+
+		fi, err := os.Stat(addr)
+		require.NoError(t, err)
+		require.Equal(t, mode, fi.Mode().Perm())
+		require.NoError(t, ln.Close())
+
+		_, err = os.Stat(addr)
+		require.True(t, os.IsNotExist(err), "the socket is removed on close")
+	}
+}
@@ -0,0 +1,22 @@
+package privval
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// ListenUnix listens on the unix socket at path and sets the mode of its file
+// right after creating it. The process umask is left alone, since it is shared
+// with every other file created concurrently.
+func ListenUnix(path string, mode os.FileMode) (*net.UnixListener, error) {
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode.Perm()); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("failed to set mode of unix socket %s: %w", path, err)
+	}
+	return ln, nil
+}
@@ -0,0 +1,81 @@
+package signer
+
+import (
+	"errors"
+	"fmt"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	cometprotoprivval "github.com/cometbft/cometbft/proto/tendermint/privval"
+)
+
+var _ HorcruxConnection = (*FallbackHorcruxConnection)(nil)
+
+// transportConnection is implemented by HorcruxConnections that can return
+// failures to reach horcrux as errors instead of encoding them in the response.
+type transportConnection interface {
+	sendRequest(request cometprotoprivval.Message) (*cometprotoprivval.Message, error)
+}
+
+// connectedConnection is implemented by HorcruxConnections that know whether
+// they currently have a connection to horcrux.
+type connectedConnection interface {
+	IsConnected() bool
+}
+
+// HorcruxConnectionPath is a named HorcruxConnection used by a
+// FallbackHorcruxConnection.
+type HorcruxConnectionPath struct {
+	Name       string
+	Connection HorcruxConnection
+}
+
+// FallbackHorcruxConnection sends each request over the first of its paths
+// and falls back to the next path in order when horcrux can't be reached.
+type FallbackHorcruxConnection struct {
+	logger cometlog.Logger
+	paths  []HorcruxConnectionPath
+}
+
+// NewFallbackHorcruxConnection returns a FallbackHorcruxConnection that tries
+// the paths in the given order.
+func NewFallbackHorcruxConnection(logger cometlog.Logger, paths ...HorcruxConnectionPath) *FallbackHorcruxConnection {
+	return &FallbackHorcruxConnection{
+		logger: logger,
+		paths:  paths,
+	}
+}
+
+// SendRequest implements HorcruxConnection.
+func (c *FallbackHorcruxConnection) SendRequest(req cometprotoprivval.Message) (*cometprotoprivval.Message, error) {
+	var errs error
+	for i, path := range c.paths {
+		if cc, ok := path.Connection.(connectedConnection); ok && !cc.IsConnected() {
+			errs = errors.Join(errs, fmt.Errorf("%s: not connected", path.Name))
+			continue
+		}
+
+		var (
+			res *cometprotoprivval.Message
+			err error
+		)
+		if tc, ok := path.Connection.(transportConnection); ok {
+			res, err = tc.sendRequest(req)
+		} else {
+			res, err = path.Connection.SendRequest(req)
+		}
+		if err != nil {
+			c.logger.Error("Failed to send request to horcrux", "path", path.Name, "err", err)
+			errs = errors.Join(errs, fmt.Errorf("%s: %w", path.Name, err))
+			continue
+		}
+
+		if i == 0 {
+			c.logger.Debug("Sent request to horcrux", "path", path.Name)
+		} else {
+			c.logger.Info("Sent request to horcrux over fallback path", "path", path.Name, "reason", errs)
+		}
+		return res, nil
+	}
+
+	return nil, fmt.Errorf("all horcrux connection paths failed: %w", errs)
+}
@@ -0,0 +1,115 @@
+package signer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	cometprotoprivval "github.com/cometbft/cometbft/proto/tendermint/privval"
+	"github.com/stretchr/testify/require"
+
+	"github.com/strangelove-ventures/horcrux-proxy/privval"
+)
+
+type mockConnection struct {
+	connected bool
+	err       error
+	requests  int
+}
+
+func (c *mockConnection) SendRequest(cometprotoprivval.Message) (*cometprotoprivval.Message, error) {
+	c.requests++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &cometprotoprivval.Message{}, nil
+}
+
+func (c *mockConnection) IsConnected() bool {
+	return c.connected
+}
+
+func TestFallbackHorcruxConnection(t *testing.T) {
+	errUnavailable := errors.New("unavailable")
+
+	tests := []struct {
+		name              string
+		primary, fallback *mockConnection
+		wantErr           bool
+		wantPrimary       int
+		wantFallback      int
+	}{
+		{
+			name:        "primary ok",
+			primary:     &mockConnection{connected: true},
+			fallback:    &mockConnection{connected: true},
+			wantPrimary: 1,
+		},
+		{
+			name:         "primary transport error",
+			primary:      &mockConnection{connected: true, err: errUnavailable},
+			fallback:     &mockConnection{connected: true},
+			wantPrimary:  1,
+			wantFallback: 1,
+		},
+		{
+			name:         "primary not connected",
+			primary:      &mockConnection{},
+			fallback:     &mockConnection{connected: true},
+			wantFallback: 1,
+		},
+		{
+			name:        "fallback not connected",
+			primary:     &mockConnection{connected: true, err: errUnavailable},
+			fallback:    &mockConnection{},
+			wantErr:     true,
+			wantPrimary: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewFallbackHorcruxConnection(cometlog.NewNopLogger(),
+				HorcruxConnectionPath{Name: "primary", Connection: tt.primary},
+				HorcruxConnectionPath{Name: "fallback", Connection: tt.fallback},
+			)
+
+			res, err := c.SendRequest(cometprotoprivval.Message{})
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				require.NotNil(t, res)
+			}
+			require.Equal(t, tt.wantPrimary, tt.primary.requests)
+			require.Equal(t, tt.wantFallback, tt.fallback.requests)
+		})
+	}
+}
+
+func TestFallbackHorcruxConnectionListenerWithoutCosigner(t *testing.T) {
+	logger := cometlog.NewNopLogger()
+	listener := privval.NewSignerListener(logger, "tcp://127.0.0.1:0")
+	lb := privval.NewRemoteSignerLoadBalancer(logger, []privval.SignerListener{listener})
+	require.NoError(t, lb.Start())
+	t.Cleanup(func() { _ = lb.Stop() })
+
+	// The listener is waiting for a cosigner to connect.
+	time.Sleep(100 * time.Millisecond)
+	require.False(t, lb.IsConnected())
+
+	fallback := &mockConnection{connected: true}
+	c := NewFallbackHorcruxConnection(logger,
+		HorcruxConnectionPath{Name: "listen", Connection: lb},
+		HorcruxConnectionPath{Name: "grpc", Connection: fallback},
+	)
+
+	start := time.Now()
+	res, err := c.SendRequest(cometprotoprivval.Message{})
+	require.NoError(t, err)
+	require.NotNil(t, res)
+	require.Equal(t, 1, fallback.requests)
+	require.Less(t, time.Since(start), time.Second, "falls back without waiting for a cosigner")
+}
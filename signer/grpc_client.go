@@ -11,10 +11,15 @@ import (
 	"github.com/strangelove-ventures/horcrux/v3/signer"
 	"github.com/strangelove-ventures/horcrux/v3/signer/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
-var _ HorcruxConnection = (*HorcruxGRPCClient)(nil)
+var (
+	_ HorcruxConnection   = (*HorcruxGRPCClient)(nil)
+	_ transportConnection = (*HorcruxGRPCClient)(nil)
+)
 
 type HorcruxGRPCClient struct {
 	grpcClient proto.RemoteSignerClient
@@ -35,7 +40,19 @@ func NewHorcruxGRPCClient(
 	}, nil
 }
 
+// SendRequest implements HorcruxConnection. Failures to reach horcrux are
+// returned to the sentry as a remote signer error in the response.
 func (c *HorcruxGRPCClient) SendRequest(req cometprotoprivval.Message) (*cometprotoprivval.Message, error) {
+	res, err := c.sendRequest(req)
+	if err != nil {
+		return errorResponse(req, err), nil
+	}
+	return res, nil
+}
+
+// sendRequest implements transportConnection. Errors reaching horcrux are
+// returned as errors, errors returned by horcrux are encoded in the response.
+func (c *HorcruxGRPCClient) sendRequest(req cometprotoprivval.Message) (*cometprotoprivval.Message, error) {
 	switch typedReq := req.Sum.(type) {
 	case *cometprotoprivval.Message_SignVoteRequest:
 		return c.handleSignVoteRequest(req)
@@ -59,23 +76,22 @@ func (c *HorcruxGRPCClient) handleSignVoteRequest(req cometprotoprivval.Message)
 		ChainID: voteReq.ChainId,
 		Block:   signer.VoteToBlock(voteReq.ChainId, vote).ToProto(),
 	})
-	if err == nil {
-		vote.Signature = res.Signature
-		vote.ExtensionSignature = res.VoteExtSignature
-		vote.Timestamp = time.Unix(0, res.Timestamp)
-		return &cometprotoprivval.Message{
-			Sum: &cometprotoprivval.Message_SignedVoteResponse{
-				SignedVoteResponse: &cometprotoprivval.SignedVoteResponse{
-					Vote: *vote,
-				},
-			},
-		}, nil
+	if err != nil {
+		if isTransportError(err) {
+			return nil, err
+		}
+		return errorResponse(req, err), nil
 	}
 
+	vote.Signature = res.Signature
+	vote.ExtensionSignature = res.VoteExtSignature
+	vote.Timestamp = time.Unix(0, res.Timestamp)
 	return &cometprotoprivval.Message{
-		Sum: &cometprotoprivval.Message_SignedVoteResponse{SignedVoteResponse: &cometprotoprivval.SignedVoteResponse{
-			Error: getRemoteSignerError(err),
-		}},
+		Sum: &cometprotoprivval.Message_SignedVoteResponse{
+			SignedVoteResponse: &cometprotoprivval.SignedVoteResponse{
+				Vote: *vote,
+			},
+		},
 	}, nil
 }
 
@@ -86,22 +102,21 @@ func (c *HorcruxGRPCClient) handleSignProposalRequest(req cometprotoprivval.Mess
 		ChainID: proposalReq.ChainId,
 		Block:   signer.ProposalToBlock(proposalReq.ChainId, proposal).ToProto(),
 	})
-	if err == nil {
-		proposal.Signature = res.Signature
-		proposal.Timestamp = time.Unix(0, res.Timestamp)
-		return &cometprotoprivval.Message{
-			Sum: &cometprotoprivval.Message_SignedProposalResponse{
-				SignedProposalResponse: &cometprotoprivval.SignedProposalResponse{
-					Proposal: *proposal,
-				},
-			},
-		}, nil
+	if err != nil {
+		if isTransportError(err) {
+			return nil, err
+		}
+		return errorResponse(req, err), nil
 	}
 
+	proposal.Signature = res.Signature
+	proposal.Timestamp = time.Unix(0, res.Timestamp)
 	return &cometprotoprivval.Message{
-		Sum: &cometprotoprivval.Message_SignedProposalResponse{SignedProposalResponse: &cometprotoprivval.SignedProposalResponse{
-			Error: getRemoteSignerError(err),
-		}},
+		Sum: &cometprotoprivval.Message_SignedProposalResponse{
+			SignedProposalResponse: &cometprotoprivval.SignedProposalResponse{
+				Proposal: *proposal,
+			},
+		},
 	}, nil
 }
 
@@ -109,24 +124,23 @@ func (c *HorcruxGRPCClient) handlePubKeyRequest(req cometprotoprivval.Message) (
 	res, err := c.grpcClient.PubKey(context.TODO(), &proto.PubKeyRequest{
 		ChainId: req.GetPubKeyRequest().ChainId,
 	})
-	if err == nil {
-		return &cometprotoprivval.Message{
-			Sum: &cometprotoprivval.Message_PubKeyResponse{
-				PubKeyResponse: &cometprotoprivval.PubKeyResponse{
-					PubKey: cometcrypto.PublicKey{
-						Sum: &cometcrypto.PublicKey_Ed25519{
-							Ed25519: res.PubKey,
-						},
-					},
-				},
-			},
-		}, nil
+	if err != nil {
+		if isTransportError(err) {
+			return nil, err
+		}
+		return errorResponse(req, err), nil
 	}
 
 	return &cometprotoprivval.Message{
-		Sum: &cometprotoprivval.Message_PubKeyResponse{PubKeyResponse: &cometprotoprivval.PubKeyResponse{
-			Error: getRemoteSignerError(err),
-		}},
+		Sum: &cometprotoprivval.Message_PubKeyResponse{
+			PubKeyResponse: &cometprotoprivval.PubKeyResponse{
+				PubKey: cometcrypto.PublicKey{
+					Sum: &cometcrypto.PublicKey_Ed25519{
+						Ed25519: res.PubKey,
+					},
+				},
+			},
+		},
 	}, nil
 }
 
@@ -138,6 +152,41 @@ func (c *HorcruxGRPCClient) handlePingRequest() (*cometprotoprivval.Message, err
 	}, nil
 }
 
+// isTransportError reports whether the gRPC error means horcrux could not be
+// reached, as opposed to horcrux refusing the request. Only Unavailable is a
+// transport error: a request that timed out or was canceled may already have
+// been signed by horcrux, so it must not be sent again over another path.
+func isTransportError(err error) bool {
+	return status.Code(err) == codes.Unavailable
+}
+
+// errorResponse returns the response to req that carries err as a remote
+// signer error.
+func errorResponse(req cometprotoprivval.Message, err error) *cometprotoprivval.Message {
+	switch req.Sum.(type) {
+	case *cometprotoprivval.Message_SignVoteRequest:
+		return &cometprotoprivval.Message{
+			Sum: &cometprotoprivval.Message_SignedVoteResponse{SignedVoteResponse: &cometprotoprivval.SignedVoteResponse{
+				Error: getRemoteSignerError(err),
+			}},
+		}
+	case *cometprotoprivval.Message_SignProposalRequest:
+		return &cometprotoprivval.Message{
+			Sum: &cometprotoprivval.Message_SignedProposalResponse{SignedProposalResponse: &cometprotoprivval.SignedProposalResponse{
+				Error: getRemoteSignerError(err),
+			}},
+		}
+	case *cometprotoprivval.Message_PubKeyRequest:
+		return &cometprotoprivval.Message{
+			Sum: &cometprotoprivval.Message_PubKeyResponse{PubKeyResponse: &cometprotoprivval.PubKeyResponse{
+				Error: getRemoteSignerError(err),
+			}},
+		}
+	default:
+		return &cometprotoprivval.Message{}
+	}
+}
+
 func getRemoteSignerError(err error) *cometprotoprivval.RemoteSignerError {
 	if err == nil {
 		return nil
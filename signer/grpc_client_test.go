@@ -0,0 +1,36 @@
+package signer
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsTransportError(t *testing.T) {
+	tests := []struct {
+		code codes.Code
+		want bool
+	}{
+		{code: codes.Unavailable, want: true},
+		{code: codes.DeadlineExceeded, want: false},
+		{code: codes.Canceled, want: false},
+		{code: codes.Unknown, want: false},
+		{code: codes.InvalidArgument, want: false},
+		{code: codes.FailedPrecondition, want: false},
+		{code: codes.PermissionDenied, want: false},
+		{code: codes.Internal, want: false},
+	}
+
+	for _, tt := range tests {
+		err := status.Error(tt.code, "horcrux")
+		require.Equal(t, tt.want, isTransportError(err), tt.code.String())
+		require.Equal(t, tt.want, isTransportError(fmt.Errorf("failed to sign vote: %w", err)), "wrapped %s", tt.code)
+	}
+
+	require.False(t, isTransportError(nil))
+	require.False(t, isTransportError(errors.New("not a gRPC error")))
+}
@@ -1,6 +1,8 @@
 package signer
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"net"
 	"time"
@@ -10,12 +12,39 @@ import (
 	cometnet "github.com/cometbft/cometbft/libs/net"
 	"github.com/cometbft/cometbft/libs/protoio"
 	cometservice "github.com/cometbft/cometbft/libs/service"
+	cometp2p "github.com/cometbft/cometbft/p2p"
 	cometp2pconn "github.com/cometbft/cometbft/p2p/conn"
 	cometprotoprivval "github.com/cometbft/cometbft/proto/tendermint/privval"
 )
 
 const sleep = 1
 
+// repeatedRequestFailures is the number of consecutive failed requests after
+// which RemoteSignerRequestsFailing is reported.
+const repeatedRequestFailures = 3
+
+// RemoteSignerEvent is a change of the connection of a ReconnRemoteSigner to its sentry.
+type RemoteSignerEvent string
+
+const (
+	// RemoteSignerConnected is reported when the secret connection to the sentry is established.
+	RemoteSignerConnected RemoteSignerEvent = "Connected"
+
+	// RemoteSignerHandshakeFailed is reported when the secret connection
+	// handshake or the node ID verification fails.
+	RemoteSignerHandshakeFailed RemoteSignerEvent = "HandshakeFailed"
+
+	// RemoteSignerDisconnected is reported when an established connection is lost.
+	RemoteSignerDisconnected RemoteSignerEvent = "Disconnected"
+
+	// RemoteSignerRequestsFailing is reported when several consecutive
+	// requests from the sentry could not be signed.
+	RemoteSignerRequestsFailing RemoteSignerEvent = "RequestsFailing"
+)
+
+// RemoteSignerEventHandler is called with each RemoteSignerEvent and its cause, if any.
+type RemoteSignerEventHandler func(event RemoteSignerEvent, err error)
+
 type HorcruxConnection interface {
 	SendRequest(request cometprotoprivval.Message) (*cometprotoprivval.Message, error)
 }
@@ -33,6 +62,41 @@ type ReconnRemoteSigner struct {
 	dialer net.Dialer
 
 	maxReadSize int
+
+	allowedChainIDs map[string]struct{}
+	expectedNodeID  cometp2p.ID
+
+	eventHandler RemoteSignerEventHandler
+}
+
+// ReconnRemoteSignerOption sets an optional parameter on the ReconnRemoteSigner.
+type ReconnRemoteSignerOption func(*ReconnRemoteSigner)
+
+// ReconnRemoteSignerAllowedChainIDs restricts the requests forwarded to horcrux
+// to the given chain IDs. Requests for other chains are answered with an error.
+// An empty list allows all chain IDs.
+func ReconnRemoteSignerAllowedChainIDs(chainIDs ...string) ReconnRemoteSignerOption {
+	return func(rs *ReconnRemoteSigner) {
+		for _, chainID := range chainIDs {
+			rs.allowedChainIDs[chainID] = struct{}{}
+		}
+	}
+}
+
+// ReconnRemoteSignerExpectedNodeID requires the sentry to authenticate the
+// secret connection with the key of the given ID.
+//
+// NOTE: stock CometBFT generates a new key for its privval listener on every
+// start, so this only works with sentries that use a stable privval key.
+func ReconnRemoteSignerExpectedNodeID(id cometp2p.ID) ReconnRemoteSignerOption {
+	return func(rs *ReconnRemoteSigner) { rs.expectedNodeID = id }
+}
+
+// ReconnRemoteSignerEventHandler sets a handler for the connection events of
+// the ReconnRemoteSigner. The handler is called from the signer's goroutine
+// and must not block.
+func ReconnRemoteSignerEventHandler(handler RemoteSignerEventHandler) ReconnRemoteSignerOption {
+	return func(rs *ReconnRemoteSigner) { rs.eventHandler = handler }
 }
 
 // NewReconnRemoteSigner return a ReconnRemoteSigner that will dial using the given
@@ -46,6 +110,7 @@ func NewReconnRemoteSigner(
 	horcruxConnection HorcruxConnection,
 	dialer net.Dialer,
 	maxReadSize int,
+	options ...ReconnRemoteSignerOption,
 ) *ReconnRemoteSigner {
 	rs := &ReconnRemoteSigner{
 		address:           address,
@@ -53,6 +118,12 @@ func NewReconnRemoteSigner(
 		horcruxConnection: horcruxConnection,
 		privKey:           cometcryptoed25519.GenPrivKey(),
 		maxReadSize:       maxReadSize,
+		allowedChainIDs:   make(map[string]struct{}),
+		eventHandler:      func(RemoteSignerEvent, error) {},
+	}
+
+	for _, optionFunc := range options {
+		optionFunc(rs)
 	}
 
 	rs.BaseService = *cometservice.NewBaseService(logger, "RemoteSigner", rs)
@@ -72,6 +143,7 @@ func (rs *ReconnRemoteSigner) OnStop() {
 // main loop for ReconnRemoteSigner
 func (rs *ReconnRemoteSigner) loop() {
 	var conn net.Conn
+	var failures int
 	for {
 		if !rs.IsRunning() {
 			if conn != nil {
@@ -96,17 +168,23 @@ func (rs *ReconnRemoteSigner) loop() {
 			}
 
 			rs.Logger.Info("Connected to Sentry", "address", rs.address)
-			conn, err = cometp2pconn.MakeSecretConnection(netConn, rs.privKey)
+			secretConn, err := cometp2pconn.MakeSecretConnection(netConn, rs.privKey)
+			if err == nil {
+				err = rs.verifyNodeID(secretConn)
+			}
 			if err != nil {
 				if err := netConn.Close(); err != nil {
 					rs.Logger.Error("Error closing netConn", "err", err)
 				}
 				conn = nil
 				rs.Logger.Error("Secret Conn", "err", err)
+				rs.eventHandler(RemoteSignerHandshakeFailed, err)
 				rs.Logger.Info("Retrying", "sleep (s)", sleep, "address", rs.address)
 				time.Sleep(time.Second * time.Duration(sleep))
 				continue
 			}
+			conn = secretConn
+			rs.eventHandler(RemoteSignerConnected, nil)
 		}
 
 		// since dialing can take time, we check running again
@@ -122,22 +200,34 @@ func (rs *ReconnRemoteSigner) loop() {
 			rs.Logger.Error("readMsg", "err", err)
 			conn.Close()
 			conn = nil
+			rs.eventHandler(RemoteSignerDisconnected, err)
 			continue
 		}
 
 		// handleRequest handles request errors. We always send back a response
-		res, err := rs.horcruxConnection.SendRequest(req)
-		if err != nil {
+		res, err := rs.handleRequest(req)
+		if err == nil && res == nil {
+			err = errors.New("nil response")
+		}
+		if err == nil {
+			err = responseError(res)
+		} else {
 			rs.Logger.Error("handleRequest", "err", err)
 			conn.Close()
 			conn = nil
-			continue
+			rs.eventHandler(RemoteSignerDisconnected, err)
 		}
 
-		if res == nil {
-			rs.Logger.Error("handleRequest", "err", "nil response")
-			conn.Close()
-			conn = nil
+		if err != nil {
+			failures++
+			if failures == repeatedRequestFailures {
+				rs.eventHandler(RemoteSignerRequestsFailing, err)
+			}
+		} else {
+			failures = 0
+		}
+
+		if conn == nil {
 			continue
 		}
 
@@ -146,8 +236,64 @@ func (rs *ReconnRemoteSigner) loop() {
 			rs.Logger.Error("writeMsg", "err", err)
 			conn.Close()
 			conn = nil
+			rs.eventHandler(RemoteSignerDisconnected, err)
+		}
+	}
+}
+
+// responseError returns the error of a response to a signing request, if any.
+func responseError(res *cometprotoprivval.Message) error {
+	var rse *cometprotoprivval.RemoteSignerError
+	switch typedRes := res.Sum.(type) {
+	case *cometprotoprivval.Message_SignedVoteResponse:
+		rse = typedRes.SignedVoteResponse.Error
+	case *cometprotoprivval.Message_SignedProposalResponse:
+		rse = typedRes.SignedProposalResponse.Error
+	case *cometprotoprivval.Message_PubKeyResponse:
+		rse = typedRes.PubKeyResponse.Error
+	}
+	if rse == nil {
+		return nil
+	}
+	return errors.New(rse.Description)
+}
+
+// verifyNodeID checks the sentry's key against the expected node ID, if any.
+func (rs *ReconnRemoteSigner) verifyNodeID(conn *cometp2pconn.SecretConnection) error {
+	if rs.expectedNodeID == "" {
+		return nil
+	}
+	if id := cometp2p.PubKeyToID(conn.RemotePubKey()); id != rs.expectedNodeID {
+		return fmt.Errorf("sentry node ID %s does not match expected node ID %s", id, rs.expectedNodeID)
+	}
+	return nil
+}
+
+// handleRequest forwards the request to horcrux if its chain ID is allowed.
+func (rs *ReconnRemoteSigner) handleRequest(req cometprotoprivval.Message) (*cometprotoprivval.Message, error) {
+	if len(rs.allowedChainIDs) > 0 {
+		if chainID, ok := requestChainID(req); ok {
+			if _, allowed := rs.allowedChainIDs[chainID]; !allowed {
+				rs.Logger.Error("Rejected request for chain ID that is not allowed", "chain_id", chainID, "address", rs.address)
+				return errorResponse(req, fmt.Errorf("chain ID %s is not allowed for this sentry", chainID)), nil
+			}
 		}
 	}
+	return rs.horcruxConnection.SendRequest(req)
+}
+
+// requestChainID returns the chain ID of the request, if it has one.
+func requestChainID(req cometprotoprivval.Message) (string, bool) {
+	switch typedReq := req.Sum.(type) {
+	case *cometprotoprivval.Message_SignVoteRequest:
+		return typedReq.SignVoteRequest.ChainId, true
+	case *cometprotoprivval.Message_SignProposalRequest:
+		return typedReq.SignProposalRequest.ChainId, true
+	case *cometprotoprivval.Message_PubKeyRequest:
+		return typedReq.PubKeyRequest.ChainId, true
+	default:
+		return "", false
+	}
 }
 
 // ReadMsg reads a message from an io.Reader
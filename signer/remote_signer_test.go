@@ -0,0 +1,145 @@
+package signer
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	cometcryptoed25519 "github.com/cometbft/cometbft/crypto/ed25519"
+	cometlog "github.com/cometbft/cometbft/libs/log"
+	cometp2pconn "github.com/cometbft/cometbft/p2p/conn"
+	cometprotoprivval "github.com/cometbft/cometbft/proto/tendermint/privval"
+	cometprototypes "github.com/cometbft/cometbft/proto/tendermint/types"
+	"github.com/stretchr/testify/require"
+)
+
+// failingConnection answers every request with a remote signer error.
+type failingConnection struct{}
+
+func (failingConnection) SendRequest(req cometprotoprivval.Message) (*cometprotoprivval.Message, error) {
+	return errorResponse(req, errors.New("cosigners unavailable")), nil
+}
+
+// erroringConnection fails every request without a response.
+type erroringConnection struct{}
+
+func (erroringConnection) SendRequest(cometprotoprivval.Message) (*cometprotoprivval.Message, error) {
+	return nil, errors.New("horcrux unreachable")
+}
+
+// startSentry accepts a single privval connection like a sentry's privval
+// listener and returns the secret connection.
+func startSentry(t *testing.T) (string, <-chan net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	conns := make(chan net.Conn, 1)
+	go func() {
+		netConn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		conn, err := cometp2pconn.MakeSecretConnection(netConn, cometcryptoed25519.GenPrivKey())
+		if err != nil {
+			return
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+		conns <- conn
+	}()
+
+	return "tcp://" + ln.Addr().String(), conns
+}
+
+func signVoteRequest(chainID string) cometprotoprivval.Message {
+	return cometprotoprivval.Message{Sum: &cometprotoprivval.Message_SignVoteRequest{
+		SignVoteRequest: &cometprotoprivval.SignVoteRequest{Vote: &cometprototypes.Vote{}, ChainId: chainID},
+	}}
+}
+
+func TestReconnRemoteSignerEvents(t *testing.T) {
+	address, conns := startSentry(t)
+
+	var mu sync.Mutex
+	var events []RemoteSignerEvent
+
+	rs := NewReconnRemoteSigner(address, cometlog.NewNopLogger(), failingConnection{}, net.Dialer{Timeout: time.Second}, 1024*1024,
+		ReconnRemoteSignerEventHandler(func(event RemoteSignerEvent, _ error) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, event)
+		}),
+	)
+	require.NoError(t, rs.Start())
+	t.Cleanup(func() { _ = rs.Stop() })
+
+	conn := <-conns
+	for i := 0; i < repeatedRequestFailures+1; i++ {
+		require.NoError(t, WriteMsg(conn, signVoteRequest("chain-a")))
+		res, err := ReadMsg(conn, 1024*1024)
+		require.NoError(t, err)
+		require.Error(t, responseError(&res))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []RemoteSignerEvent{RemoteSignerConnected, RemoteSignerRequestsFailing}, events)
+}
+
+func TestReconnRemoteSignerRequestErrorDisconnects(t *testing.T) {
+	address, conns := startSentry(t)
+
+	var mu sync.Mutex
+	var events []RemoteSignerEvent
+
+	rs := NewReconnRemoteSigner(address, cometlog.NewNopLogger(), erroringConnection{}, net.Dialer{Timeout: time.Second}, 1024*1024,
+		ReconnRemoteSignerEventHandler(func(event RemoteSignerEvent, _ error) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, event)
+		}),
+	)
+	require.NoError(t, rs.Start())
+	t.Cleanup(func() { _ = rs.Stop() })
+
+	conn := <-conns
+	require.NoError(t, WriteMsg(conn, signVoteRequest("chain-a")))
+	_, err := ReadMsg(conn, 1024*1024)
+	require.Error(t, err, "the connection is closed without a response")
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []RemoteSignerEvent{RemoteSignerConnected, RemoteSignerDisconnected}, events[:2])
+}
+
+func TestReconnRemoteSignerAllowedChainIDs(t *testing.T) {
+	address, conns := startSentry(t)
+
+	hc := &mockConnection{connected: true}
+	rs := NewReconnRemoteSigner(address, cometlog.NewNopLogger(), hc, net.Dialer{Timeout: time.Second}, 1024*1024,
+		ReconnRemoteSignerAllowedChainIDs("chain-a"),
+	)
+	require.NoError(t, rs.Start())
+	t.Cleanup(func() { _ = rs.Stop() })
+
+	conn := <-conns
+
+	require.NoError(t, WriteMsg(conn, signVoteRequest("chain-b")))
+	res, err := ReadMsg(conn, 1024*1024)
+	require.NoError(t, err)
+	require.ErrorContains(t, responseError(&res), "chain ID chain-b is not allowed")
+
+	require.NoError(t, WriteMsg(conn, signVoteRequest("chain-a")))
+	_, err = ReadMsg(conn, 1024*1024)
+	require.NoError(t, err)
+
+	require.Equal(t, 1, hc.requests)
+}